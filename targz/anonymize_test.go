@@ -0,0 +1,66 @@
+//go:build unix
+
+package targz
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//WithAnonymizeOwners之后目录、文件、符号链接和硬链接的tar头中都没有运行者的uid、gid和用户名
+func TestAnonymizeOwners(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"dir/a.txt": "a"})
+	if err := os.Symlink("dir/a.txt", filepath.Join(src, "sym")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "dir", "a.txt"), filepath.Join(src, "hard")); err != nil {
+		t.Fatal(err)
+	}
+
+	//root运行时uid本来就是0，改成别的属主才能看出是否清除了
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1234, 1234
+		err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain, err := TarBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr := tarHeaders(t, plain)["dir/a.txt"]; hdr == nil || hdr.Uid != uid {
+		t.Fatalf("不隐藏时的tar头是%v", hdr)
+	}
+
+	data, err := TarBytes(src, WithAnonymizeOwners(), WithoutExtraTimes(), WithFormat(tar.FormatPAX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := tarHeaders(t, data)
+	types := make(map[byte]bool)
+	for name, hdr := range headers {
+		types[hdr.Typeflag] = true
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s的属主是%d:%d（%q:%q）", name, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if !hdr.AccessTime.IsZero() || !hdr.ChangeTime.IsZero() {
+			t.Errorf("%s保存了访问时间或者状态改变时间", name)
+		}
+	}
+	for _, typ := range []byte{tar.TypeDir, tar.TypeReg, tar.TypeSymlink, tar.TypeLink} {
+		if !types[typ] {
+			t.Errorf("没有类型为%q的项", typ)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package targz
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//向已有的.tar.gz文件中追加文件或者目录，每个源以自己的名称作为包内的顶层，同TarAll
+//压缩后的数据无法原地追加，所以会把原有的内容和新的项写入同一目录下的临时文件，成功后再替换原文件，
+//任何一步失败都不会改动原文件
+//新的项和原有的项同名时返回错误，可以用WithAppendReplace改为替换原有的项
+func Append(archive string, srcs ...string) error {
+	return AppendWithOptions(archive, srcs)
+}
+
+//同Append，通过opts调整新加入的项的打包行为
+func AppendWithOptions(archive string, srcs []string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	//新的压缩包和原来的使用同样的格式
+	if err := o.compressionFor(archive); err != nil {
+		return err
+	}
+
+	if len(srcs) == 0 {
+		return errors.New("没有指定要追加的文件或者目录")
+	}
+	cleaned, err := checkSrcs(srcs)
+	if err != nil {
+		return err
+	}
+
+	archiveInfo, err := os.Stat(archive)
+	if err != nil {
+		return err
+	}
+
+	//先列出新加入的项，复制原有的项时才能发现同名的项
+	plan := newPacker(context.Background(), nil, o)
+	plan.dryRun = true
+	for _, src := range cleaned {
+		if err := plan.tarRooted(src); err != nil {
+			return err
+		}
+	}
+	if err := plan.tarExtras(); err != nil {
+		return err
+	}
+	added := make(map[string]byte, len(plan.entries))
+	for _, e := range plan.entries {
+		added[e.Name] = e.Typeflag
+	}
+
+	//打开原有的压缩包
+	fr, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	gr, err := newDecompressReader(fr, o)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	//在同一目录下创建临时文件，保证最后的Rename是原子的
+	tmp, err := ioutil.TempFile(filepath.Dir(archive), filepath.Base(archive)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && !isPartial(err) {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	o.skipSelf(archive, tmp.Name())
+
+	//ContinueOnError时部分项出错，压缩包仍然是完整的，照常替换原文件后返回这个错误
+	partial := appendTo(tmp, tar.NewReader(gr), cleaned, added, o)
+	if partial != nil && !isPartial(partial) {
+		return partial
+	}
+
+	//保持原文件的权限
+	if err := tmp.Chmod(archiveInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	if o.sync {
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), archive); err != nil {
+		return err
+	}
+	if o.sync {
+		if err := syncDir(filepath.Dir(archive)); err != nil {
+			return err
+		}
+	}
+	return partial
+}
+
+//把tr中原有的项和srcs中新的项一起写入w
+func appendTo(w io.Writer, tr *tar.Reader, srcs []string, added map[string]byte, o *options) (err error) {
+	tw, closeTw, err := newTarGzWriter(&countingWriter{w: w, limit: o.maxArchiveSize}, o)
+	if err != nil {
+		return err
+	}
+	p := newPacker(context.Background(), tw, o)
+	defer func() {
+		if er := closeTw(); er != nil && err == nil {
+			err = er
+		}
+		p.nameSizeError(err)
+	}()
+
+	//复制原有的项
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		if err != nil {
+			return err
+		}
+
+		if typeflag, ok := added[hdr.Name]; ok {
+			//两边都是目录时不算冲突，原有的目录项由新的目录项代替
+			if !o.appendReplace && !(typeflag == tar.TypeDir && hdr.Typeflag == tar.TypeDir) {
+				return fmt.Errorf("要追加的项在压缩包中已存在：%s", hdr.Name)
+			}
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		p.current = hdr.Name
+		if o.entryCallback != nil {
+			o.entryCallback(hdr.Name, hdr)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	//写入新的项
+	for _, src := range srcs {
+		if err := p.tarRooted(src); err != nil {
+			return err
+		}
+	}
+	if err := p.tarExtras(); err != nil {
+		return err
+	}
+	return multiError(p.errs)
+}
@@ -0,0 +1,80 @@
+package targz
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+//保存一组选项的打包器，多次打包之间复用gzip.Writer，适合频繁生成大量小压缩包的服务
+//可以在多个goroutine中同时使用，每次打包从池中取出一个gzip.Writer，结束后放回；
+//WithStats、WithTee等带有状态的选项会被所有调用共用，需要时通过每次调用的opts传入
+type Archiver struct {
+	opts  []Option
+	pools *gzipPools
+}
+
+//按opts创建Archiver，opts中的错误在这里返回
+func NewArchiver(opts ...Option) (*Archiver, error) {
+	if _, err := newOptions(opts); err != nil {
+		return nil, err
+	}
+	return &Archiver{opts: opts, pools: &gzipPools{}}, nil
+}
+
+//同TarWithOptions，使用Archiver的选项，opts追加在后面
+func (a *Archiver) Tar(src string, dest string, opts ...Option) error {
+	return TarWithOptions(src, dest, a.options(opts)...)
+}
+
+//同TarToWriter，使用Archiver的选项，opts追加在后面
+func (a *Archiver) TarToWriter(src string, w io.Writer, opts ...Option) error {
+	return TarToWriter(src, w, a.options(opts)...)
+}
+
+//合并Archiver和每次调用的选项，不修改a.opts
+func (a *Archiver) options(opts []Option) []Option {
+	all := make([]Option, 0, len(a.opts)+len(opts)+1)
+	all = append(all, a.opts...)
+	all = append(all, opts...)
+	pools := a.pools
+	return append(all, func(o *options) error {
+		o.gzipPools = pools
+		return nil
+	})
+}
+
+//按压缩级别分开的gzip.Writer池，级别从gzip.HuffmanOnly到gzip.BestCompression
+type gzipPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+//从池中取出级别为level的gzip.Writer并改为写入w，Close时放回池中
+func (ps *gzipPools) get(w io.Writer, level int, header gzip.Header) (io.WriteCloser, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return gzip.NewWriterLevel(w, level)
+	}
+	pool := &ps[level-gzip.HuffmanOnly]
+	gw, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		gw.Reset(w)
+	} else {
+		var err error
+		if gw, err = gzip.NewWriterLevel(w, level); err != nil {
+			return nil, err
+		}
+	}
+	gw.Header = header
+	return &pooledGzipWriter{Writer: gw, pool: pool}, nil
+}
+
+//关闭后把gzip.Writer放回池中
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
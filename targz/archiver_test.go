@@ -0,0 +1,34 @@
+package targz
+
+import (
+	"io"
+	"testing"
+)
+
+//Archiver复用gzip.Writer，和BenchmarkTarToWriter比较每次打包的分配
+func BenchmarkArchiverTarToWriter(b *testing.B) {
+	src := benchTree(b, 10, 1<<10)
+	a, err := NewArchiver()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.TarToWriter(src, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//每次打包都新建gzip.Writer
+func BenchmarkTarToWriter(b *testing.B) {
+	src := benchTree(b, 10, 1<<10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := TarToWriter(src, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
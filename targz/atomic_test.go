@@ -0,0 +1,73 @@
+package targz
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//覆盖已存在的dest时打包中途失败，原来的dest保持不变并且可以正常解压，也不留下临时文件
+func TestTarFailureKeepsDest(t *testing.T) {
+	for _, direct := range []bool{false, true} {
+		out := t.TempDir()
+		dest := filepath.Join(out, "backup.tar.gz")
+		old := t.TempDir()
+		writeTree(t, old, map[string]string{"old.txt": "last night"})
+		if err := TarWithOptions(old, dest); err != nil {
+			t.Fatal(err)
+		}
+		original, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		src := t.TempDir()
+		writeTree(t, src, map[string]string{"a.txt": "a", "b.txt": "b", "c/d.txt": "d", "e.txt": "e"})
+		ctx, cancel := context.WithCancel(context.Background())
+		n := 0
+		opts := []Option{WithOverwrite(), WithFilter(func(string, os.FileInfo) bool {
+			//已经写入了一部分内容之后失败
+			if n++; n == 3 {
+				cancel()
+			}
+			return true
+		})}
+		if direct {
+			opts = append(opts, WithDirectWrite())
+		}
+		if err := TarContext(ctx, src, dest, opts...); err == nil {
+			t.Fatalf("direct=%v 打包没有失败", direct)
+		}
+		cancel()
+
+		data, err := os.ReadFile(dest)
+		if err != nil || !bytes.Equal(data, original) {
+			t.Fatalf("direct=%v 原来的dest被改动了：%v", direct, err)
+		}
+		files, err := UnTarToMap(data)
+		if err != nil || !reflect.DeepEqual(files, map[string][]byte{"old.txt": []byte("last night")}) {
+			t.Fatalf("direct=%v 原来的dest无法解压：%q %v", direct, files, err)
+		}
+		if names := dirNames(t, out); !reflect.DeepEqual(names, []string{"backup.tar.gz"}) {
+			t.Fatalf("direct=%v 留下了临时文件：%v", direct, names)
+		}
+	}
+}
+
+//返回目录下的文件名
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
@@ -0,0 +1,57 @@
+package targz
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+//复制文件内容时默认的缓冲区大小，和io.Copy相同
+const defaultBufferSize = 32 * 1024
+
+//设置打包和解压时复制文件内容的缓冲区大小，默认32KB
+//缓冲区从池中取用，打包大量小文件时不会为每个文件分配；大文件较多、存储很快时可以调大，例如1MB
+func WithBufferSize(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return errors.New("缓冲区大小必须大于0")
+		}
+		o.bufferSize = n
+		return nil
+	}
+}
+
+//各种大小的缓冲区池，键为大小，值为*sync.Pool
+var bufferPools sync.Map
+
+//从池中取出size字节的缓冲区，size不大于0时使用默认大小
+func getBuffer(size int) *[]byte {
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	pool, ok := bufferPools.Load(size)
+	if !ok {
+		pool, _ = bufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, size)
+				return &b
+			},
+		})
+	}
+	return pool.(*sync.Pool).Get().(*[]byte)
+}
+
+//把getBuffer取出的缓冲区放回池中
+func putBuffer(b *[]byte) {
+	if pool, ok := bufferPools.Load(len(*b)); ok {
+		pool.(*sync.Pool).Put(b)
+	}
+}
+
+//用池中size字节的缓冲区把r复制到w
+//隐藏w的ReadFrom和r的WriteTo，tar.Writer、tar.Reader、*os.File实现的这两个方法内部会另外分配缓冲区
+func copyBuffer(w io.Writer, r io.Reader, size int) (int64, error) {
+	buf := getBuffer(size)
+	defer putBuffer(buf)
+	return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, *buf)
+}
@@ -0,0 +1,59 @@
+package targz
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//在b.TempDir()下生成n个size字节的文件
+func benchTree(b *testing.B, n int, size int) string {
+	b.Helper()
+	root := b.TempDir()
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	for i := 0; i < n; i++ {
+		name := filepath.Join(root, fmt.Sprintf("d%02d", i%16), fmt.Sprintf("f%04d", i))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(name, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return root
+}
+
+//分别用默认的缓冲区和调大的缓冲区打包src，不压缩，只比较复制内容的开销
+func benchBufferSize(b *testing.B, src string, tuned int) {
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{fmt.Sprintf("buffer=%d", tuned), []Option{WithBufferSize(tuned)}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := TarToWriter(src, io.Discard, append(c.opts, WithCompression(None))...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+//大量小文件：1000个1KB的文件，缓冲区从池中取用，不会每个文件分配一次
+func BenchmarkBufferSmallFiles(b *testing.B) {
+	benchBufferSize(b, benchTree(b, 1000, 1<<10), 4<<10)
+}
+
+//少量大文件：4个16MB的文件，调大缓冲区可以减少读写的次数
+func BenchmarkBufferHugeFiles(b *testing.B) {
+	benchBufferSize(b, benchTree(b, 4, 16<<20), 1<<20)
+}
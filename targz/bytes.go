@@ -0,0 +1,115 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+//TarBytes和UnTarToMap默认最多在内存中保存这么多数据
+const defaultMemoryLimit = 256 << 20
+
+//UnTarToMap按tar头中的大小为每个文件预先分配的最大字节数
+const maxPrealloc = 1 << 20
+
+//TarBytes生成的数据或者UnTarToMap解压的内容超出内存限制时返回的错误
+var ErrMemoryLimit = errors.New("超出了内存限制")
+
+//将文件或者目录打成.tar.gz的数据，直接返回[]byte，适合很小的压缩包
+//压缩后的数据超过内存限制（默认256MB，可以用WithMemoryLimit调整）时返回ErrMemoryLimit
+func TarBytes(src string, opts ...Option) ([]byte, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return nil, errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	buf := &limitedBuffer{limit: o.memoryLimit}
+	err = tarToWriter(context.Background(), buf, o, func(p *packer) error {
+		return p.tarSrc(src)
+	})
+	if err != nil && !isPartial(err) {
+		return nil, err
+	}
+	return buf.Bytes(), err
+}
+
+//将内存中的.tar.gz数据解压到dstDir文件夹下
+func UnTarBytes(data []byte, dstDir string, opts ...Option) error {
+	return UnTarFromReader(bytes.NewReader(data), dstDir, opts...)
+}
+
+//将内存中的.tar.gz数据解压到map中，键是包内的名称，值是文件的内容，适合很小的压缩包
+//只保存普通文件，目录、链接等其他类型的项会被忽略
+//解压后的内容超过内存限制（默认256MB，可以用WithMemoryLimit调整）时返回ErrMemoryLimit
+//WithMaxEntries、WithMaxEntrySize、WithMaxExtractSize和WithMaxCompressionRatio同样有效，超出时返回*ExtractLimitError
+func UnTarToMap(data []byte, opts ...Option) (map[string][]byte, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &countingReader{r: bytes.NewReader(data)}
+	gr, err := newDecompressReader(cr, o)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	//不写入磁盘，只借用unpacker检查解压的限制
+	u := &unpacker{opts: o, compressed: &cr.n}
+	files := make(map[string][]byte)
+	var total int64
+	tr := tar.NewReader(gr)
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if err := u.checkEntry(hdr); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		//读取之前先按tar头中的大小检查，不会为超出限制的文件分配内存
+		total += hdr.Size
+		if o.memoryLimit > 0 && total > o.memoryLimit {
+			return nil, fmt.Errorf("%w：解压到%s时超过了%d字节", ErrMemoryLimit, hdr.Name, o.memoryLimit)
+		}
+
+		//tar头中的大小可能是伪造的，最多只预先分配maxPrealloc字节，之后随着实际读出的数据增长
+		prealloc := hdr.Size
+		if prealloc > maxPrealloc {
+			prealloc = maxPrealloc
+		}
+		content := bytes.NewBuffer(make([]byte, 0, prealloc))
+		if _, err := content.ReadFrom(u.limitReader(hdr.Name, tr)); err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = content.Bytes()
+	}
+	return files, nil
+}
+
+//有大小限制的bytes.Buffer
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int64 //小于等于0表示不限制
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.Len()+len(p)) > b.limit {
+		return 0, fmt.Errorf("%w：压缩后的数据超过了%d字节", ErrMemoryLimit, b.limit)
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,32 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+//tar头中的大小是伪造的巨大值时，不限制内存也只返回错误，不会按它分配内存
+func TestUnTarToMapForgedSize(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	hdr := &tar.Header{Name: "huge", Mode: 0644, Size: 1 << 40, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("only a few bytes")); err != nil {
+		t.Fatal(err)
+	}
+	//不调用tw.Close，内容比tar头中记录的短
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limit := range []int64{0, -1} {
+		if files, err := UnTarToMap(buf.Bytes(), WithMemoryLimit(limit)); err == nil {
+			t.Fatalf("WithMemoryLimit(%d)时没有返回错误：%d项", limit, len(files))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"strconv"
+)
+
+//WithMetadataOnly时保存文件原来大小的PAX记录
+const sizePAXKey = "GOUTILS.size"
+
+//只打包元数据，不读取也不写入文件内容，生成的目录包可以很快地列出一个很大的文件系统中有哪些文件
+//普通文件的tar头中Size为0，原来的大小保存在PAX记录GOUTILS.size中，其他tar工具列出时大小显示为0；
+//名称、权限、时间、所有者等和正常打包相同。List会识别这样的项，返回原来的大小并把MetadataOnly设置为true；
+//UnTar等解压函数遇到这样的项返回ErrMetadataOnly，不会解压出空文件
+//只能使用PAX格式，不能和WithChecksums、WithDedupe、WithManifest同时使用；WithExtraEntry的项仍然包含内容
+func WithMetadataOnly() Option {
+	return func(o *options) error {
+		o.metadataOnly = true
+		return nil
+	}
+}
+
+//解压WithMetadataOnly生成的目录包时返回的错误
+var ErrMetadataOnly = errors.New("这是只有元数据的目录包，没有文件内容，无法解压")
+
+//WithMetadataOnly时把普通文件的大小移到PAX记录中，不再写入内容
+func toMetadataOnly(hdr *tar.Header) {
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	hdr.PAXRecords[sizePAXKey] = strconv.FormatInt(hdr.Size, 10)
+	hdr.Size = 0
+	if hdr.Format == tar.FormatUnknown {
+		hdr.Format = tar.FormatPAX
+	}
+}
+
+//WithMetadataOnly写入的项返回原来的大小和true
+func metadataOnlySize(hdr *tar.Header) (int64, bool) {
+	v, ok := hdr.PAXRecords[sizePAXKey]
+	if !ok || hdr.Typeflag != tar.TypeReg {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
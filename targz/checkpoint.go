@@ -0,0 +1,465 @@
+package targz
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//断点和写了一半的压缩包对不上，或者源在断点之前的部分有变化，无法继续打包时返回的错误
+//可以用errors.Is判断，这时只能删除断点重新打包
+var ErrCheckpointStale = errors.New("无法从断点继续打包")
+
+//打包很大的目录时每隔interval把进度记录到path中，中途失败或者进程被杀掉之后可以用ResumeTar继续
+//打包过程中内容写入dest.partial，完全成功后才Rename为dest并删除path，失败时两者都保留；
+//每次记录断点时结束当前的gzip成员并Sync，已经写入的部分是完整的多成员gzip，续传时截断到这里再接着写
+//path或者dest.partial已经存在时不会覆盖，返回包装了ErrExist的错误，这时应该用ResumeTar继续或者先删除它们
+//只能用于Tar、TarWithOptions和TarContext，压缩格式只能是gzip或者不压缩的tar
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(o *options) error {
+		if path == "" {
+			return errors.New("断点文件的路径不能为空")
+		}
+		if interval <= 0 {
+			return errors.New("记录断点的间隔必须大于0")
+		}
+		o.checkpoint, o.checkpointInterval = path, interval
+		return nil
+	}
+}
+
+//按WithCheckpoint记录的断点继续打包，dest必须和原来的目标相同，opts必须和原来的选项相同
+//续传时重新遍历源，断点之前的项只比较名称、大小和修改时间，不再读取内容；有任何不同、
+//或者dest.partial在断点之前的内容被改动过，都返回包装了ErrCheckpointStale的错误，不会生成压缩包
+//断点之前的硬链接和WithDedupe找到的重复文件，续传之后会按普通文件打包；WithStats只统计这次写入的项
+func ResumeTar(checkpoint string, dest string, opts ...Option) error {
+	data, err := ioutil.ReadFile(checkpoint)
+	if err != nil {
+		return err
+	}
+	var state checkpointFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%w：断点文件已损坏：%v", ErrCheckpointStale, err)
+	}
+	if state.Version != 1 {
+		return fmt.Errorf("不支持的断点版本：%d", state.Version)
+	}
+
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if abs != state.Dest {
+		return fmt.Errorf("断点记录的目标是%s，不是%s", state.Dest, abs)
+	}
+	if !Exists(state.Src) {
+		return fmt.Errorf("%w：要打包的文件或者目录已经不存在：%s", ErrCheckpointStale, state.Src)
+	}
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	o.checkpoint, o.checkpointInterval = checkpoint, state.Interval
+	o.compression, o.compressor, o.gzipLevel = state.Compression, nil, state.Level
+	o.keepBaseDir = state.KeepBaseDir
+	if err := o.validate(); err != nil {
+		return err
+	}
+	return tarCheckpointed(context.Background(), state.Src, state.Dest, o, &state)
+}
+
+//断点文件的内容
+type checkpointFile struct {
+	Version     int           `json:"version"`
+	Src         string        `json:"src"`  //要打包的文件或者目录的绝对路径
+	Dest        string        `json:"dest"` //压缩包的绝对路径
+	Partial     string        `json:"partial"`
+	Compression Compression   `json:"compression"`
+	Level       int           `json:"level"`
+	KeepBaseDir bool          `json:"keepBaseDir"`
+	Interval    time.Duration `json:"interval"`
+	Next        string        `json:"next"`       //下一个要处理的项，以`/`分隔的相对路径，为空表示还没有开始
+	Entries     int           `json:"entries"`    //Next之前经过的项数
+	SourceHash  string        `json:"sourceHash"` //Next之前经过的项的名称、大小和修改时间的SHA-256
+	Offset      int64         `json:"offset"`     //Partial中已经完整写入的压缩数据的长度
+	CRC         uint32        `json:"crc"`        //Partial前Offset字节的CRC-32
+	TarOffset   int64         `json:"tarOffset"`  //Offset对应的tar流的长度
+	Digest      []byte        `json:"digest"`     //TarOffset之前的tar流的SHA-256的中间状态，用于Stats.ContentDigest
+	Time        time.Time     `json:"time"`
+}
+
+//续传时一项相对于断点的位置
+type resumePos int
+
+const (
+	resumeNone     resumePos = iota //已经越过断点或者不是续传，照常打包
+	resumeBefore                    //在断点之前，已经写入了压缩包
+	resumeAncestor                  //断点所在的上层目录，目录本身在其下的内容之后才写入，还没有写入
+)
+
+//WithCheckpoint时的状态
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	o        *options
+	state    checkpointFile //最近一次记录的断点
+	f        *os.File       //写了一半的压缩包
+
+	tw  *tar.Writer
+	out *memberWriter
+	crc *crcWriter
+
+	hash    hash.Hash //经过的项的名称、大小和修改时间
+	entries int       //经过的项数
+	next    []string  //续传时断点所在的项，越过之后为nil
+	saved   time.Time //上次记录断点的时间
+}
+
+//创建dest.partial和断点文件，或者按state打开写了一半的压缩包，然后打包并在成功后Rename为dest
+func tarCheckpointed(ctx context.Context, src string, dest string, o *options, state *checkpointFile) (err error) {
+	if o.compressor != nil || (o.compression != Gzip && o.compression != None) {
+		return fmt.Errorf("WithCheckpoint只能用于gzip格式或者不压缩的tar，不能用于%s", o.compression)
+	}
+
+	c := &checkpointer{path: o.checkpoint, interval: o.checkpointInterval, o: o, hash: sha256.New()}
+	if state == nil {
+		err = c.create(src, dest)
+	} else {
+		err = c.reopen(state)
+	}
+	if err != nil {
+		return err
+	}
+	o.skipSelf(dest, c.f.Name(), c.path)
+	o.checkpointer = c
+	c.saved = time.Now()
+
+	err = tarToWriter(ctx, c.f, o, func(p *packer) error {
+		if err := p.tarSrc(src); err != nil {
+			return err
+		}
+		//断点和之后的项都已经不存在时，在这里比较断点之前的部分
+		return c.arrived()
+	})
+	return c.finish(err)
+}
+
+//开始新的打包：检查dest，创建断点文件和dest.partial并写入最初的断点
+//断点文件或者dest.partial已经存在时返回包装了ErrExist的错误，不会覆盖它们
+func (c *checkpointer) create(src string, dest string) error {
+	var err error
+	if src, err = filepath.Abs(src); err != nil {
+		return err
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		switch c.o.overwrite {
+		case OverwriteSkip:
+			return ErrSkipped
+		case OverwriteFail:
+			return fmt.Errorf("%w：%s", ErrExist, dest)
+		}
+	}
+
+	c.state = checkpointFile{
+		Version:     1,
+		Src:         src,
+		Dest:        dest,
+		Partial:     dest + ".partial",
+		Compression: c.o.compression,
+		Level:       c.o.gzipLevel,
+		KeepBaseDir: c.o.keepBaseDir,
+		Interval:    c.interval,
+		SourceHash:  hex.EncodeToString(c.hash.Sum(nil)),
+		Time:        time.Now(),
+	}
+	//断点文件或者dest.partial已经存在时不能覆盖，用O_EXCL创建，检查和创建是一步完成的
+	cp, err := createExclusive(c.path, OverwriteFail)
+	if err != nil {
+		return unfinished(err)
+	}
+	cp.Close()
+	if c.f, err = createExclusive(c.state.Partial, OverwriteFail); err != nil {
+		os.Remove(c.path)
+		return unfinished(err)
+	}
+	if err := c.write(); err != nil {
+		c.f.Close()
+		os.Remove(c.state.Partial)
+		os.Remove(c.path)
+		return err
+	}
+	return nil
+}
+
+//断点文件或者dest.partial已经存在，说明有没有完成的打包，提示用ResumeTar继续或者删除后重新打包
+func unfinished(err error) error {
+	if errors.Is(err, ErrExist) {
+		return fmt.Errorf("%w，可能是没有完成的打包，可以用ResumeTar继续，或者删除后重新打包", err)
+	}
+	return err
+}
+
+//续传：检查dest.partial在断点之前的内容，截断到断点
+func (c *checkpointer) reopen(state *checkpointFile) error {
+	f, err := os.OpenFile(state.Partial, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w：写了一半的压缩包已经不存在：%s", ErrCheckpointStale, state.Partial)
+		}
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(crc, io.LimitReader(f, state.Offset))
+	if err == nil && (n != state.Offset || crc.Sum32() != state.CRC) {
+		err = fmt.Errorf("%w：%s在断点之前的内容和断点记录的不一致", ErrCheckpointStale, state.Partial)
+	}
+	if err == nil {
+		err = f.Truncate(state.Offset)
+	}
+	if err == nil {
+		_, err = f.Seek(state.Offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c.f, c.state = f, *state
+	if state.Next != "" {
+		c.next = strings.Split(state.Next, "/")
+	}
+	return nil
+}
+
+//在cw上创建可以分段结束的压缩和tar，续传时从断点记录的偏移和CRC接着计算
+func (c *checkpointer) newTarWriter(cw io.Writer) (*tar.Writer, func() error, error) {
+	if len(c.state.Digest) > 0 {
+		if err := c.o.digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(c.state.Digest); err != nil {
+			return nil, nil, fmt.Errorf("%w：断点中的摘要状态无效：%v", ErrCheckpointStale, err)
+		}
+	}
+	c.crc = &crcWriter{w: cw, n: c.state.Offset, crc: c.state.CRC}
+	c.out = &memberWriter{w: c.crc, o: c.o, n: c.state.TarOffset}
+	if err := c.out.start(); err != nil {
+		return nil, nil, err
+	}
+	c.tw = tar.NewWriter(c.out)
+	return c.tw, closeTarGz(c.tw, c.out), nil
+}
+
+//遍历到srcRelative时调用，返回它相对于断点的位置；不是续传时按间隔记录断点
+func (c *checkpointer) pass(srcRelative string, fi os.FileInfo) (resumePos, error) {
+	if c == nil {
+		return resumeNone, nil
+	}
+	name := filepath.ToSlash(strings.TrimSuffix(srcRelative, string(os.PathSeparator)))
+	pos := resumeNone
+	if c.next != nil {
+		pos = walkPosition(strings.Split(name, "/"), c.next)
+		if pos == resumeNone {
+			if err := c.arrived(); err != nil {
+				return pos, err
+			}
+		}
+	} else if time.Since(c.saved) >= c.interval {
+		if err := c.save(name); err != nil {
+			return pos, fmt.Errorf("记录断点失败：%w", err)
+		}
+	}
+
+	if fi.IsDir() {
+		fmt.Fprintf(c.hash, "%s/\n", name)
+	} else {
+		fmt.Fprintf(c.hash, "%s\x00%d\x00%d\n", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+	c.entries++
+	return pos, nil
+}
+
+//续传越过断点时，确认之前经过的项和断点记录的一致
+func (c *checkpointer) arrived() error {
+	if c.next == nil {
+		return nil
+	}
+	c.next = nil
+	if c.entries != c.state.Entries {
+		return fmt.Errorf("%w：%s在断点之前有%d项，断点记录的是%d项", ErrCheckpointStale, c.state.Src, c.entries, c.state.Entries)
+	}
+	if hex.EncodeToString(c.hash.Sum(nil)) != c.state.SourceHash {
+		return fmt.Errorf("%w：%s在断点之前的文件有变化", ErrCheckpointStale, c.state.Src)
+	}
+	return nil
+}
+
+//续传时还没有越过断点，不需要写入断点之前的项
+func (c *checkpointer) resuming() bool {
+	return c != nil && c.next != nil
+}
+
+//结束当前的压缩成员并写入磁盘，记录next之前的状态
+func (c *checkpointer) save(next string) error {
+	//写出上一项补齐的0
+	if err := c.tw.Flush(); err != nil {
+		return err
+	}
+	if err := c.out.restart(); err != nil {
+		return err
+	}
+	if err := c.f.Sync(); err != nil {
+		return err
+	}
+
+	c.state.Next = next
+	c.state.Entries = c.entries
+	c.state.SourceHash = hex.EncodeToString(c.hash.Sum(nil))
+	c.state.Offset, c.state.CRC = c.crc.n, c.crc.crc
+	c.state.TarOffset = c.out.n
+	digest, err := c.o.digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c.state.Digest = digest
+	c.state.Time = time.Now()
+	c.saved = c.state.Time
+	return c.write()
+}
+
+//在原来的文件中写入断点，不改变文件的inode，打包时可以一直跳过它
+func (c *checkpointer) write() error {
+	data, err := json.MarshalIndent(&c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if er := f.Close(); er != nil && err == nil {
+		err = er
+	}
+	return err
+}
+
+//打包成功时把dest.partial改名为dest并删除断点，失败时两者都保留，可以用ResumeTar继续
+//ContinueOnError时部分项出错，压缩包仍然是完整的，照常保存后返回原来的错误
+func (c *checkpointer) finish(err error) error {
+	if err != nil && !isPartial(err) {
+		c.f.Close()
+		return err
+	}
+	if c.o.sync {
+		if er := c.f.Sync(); er != nil {
+			c.f.Close()
+			return er
+		}
+	}
+	if er := c.f.Close(); er != nil {
+		return er
+	}
+	if er := os.Rename(c.state.Partial, c.state.Dest); er != nil {
+		return er
+	}
+	os.Remove(c.path)
+	if c.o.sync {
+		if er := syncDir(filepath.Dir(c.state.Dest)); er != nil {
+			return er
+		}
+	}
+	return err
+}
+
+//按遍历的顺序比较两个以`/`分隔的路径：目录下的项按名称排序，目录本身在其下的内容之后写入
+func walkPosition(name []string, next []string) resumePos {
+	for i := 0; i < len(name) && i < len(next); i++ {
+		if name[i] != next[i] {
+			if name[i] < next[i] {
+				return resumeBefore
+			}
+			return resumeNone
+		}
+	}
+	if len(name) < len(next) {
+		return resumeAncestor
+	}
+	return resumeNone
+}
+
+//遍历到srcRelative时检查断点，出错时压缩包不能再继续写入
+func (p *packer) resumePos(srcRelative string, fi os.FileInfo) (resumePos, error) {
+	pos, err := p.checkpoint.pass(srcRelative, fi)
+	if err != nil {
+		p.broken = true
+	}
+	return pos, err
+}
+
+//可以结束当前的压缩成员再开始新成员的压缩，拼接起来的多成员gzip和一个完整的gzip解压结果相同
+type memberWriter struct {
+	w   io.Writer
+	o   *options
+	cur io.WriteCloser
+	n   int64 //写入的未压缩的字节数
+}
+
+func (w *memberWriter) start() error {
+	cur, err := newCompressStream(w.w, w.o)
+	if err != nil {
+		return err
+	}
+	w.cur = cur
+	return nil
+}
+
+func (w *memberWriter) Write(p []byte) (int, error) {
+	n, err := w.cur.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+//结束当前的成员，之后写入的内容进入新的成员
+func (w *memberWriter) restart() error {
+	if err := w.cur.Close(); err != nil {
+		return err
+	}
+	return w.start()
+}
+
+func (w *memberWriter) Close() error {
+	return w.cur.Close()
+}
+
+//计算写入内容的CRC-32和长度
+type crcWriter struct {
+	w   io.Writer
+	n   int64
+	crc uint32
+}
+
+func (w *crcWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p[:n])
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,105 @@
+package targz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//生成一个有72个文件的目录，每个文件的内容都不同
+func checkpointTree(t *testing.T) string {
+	t.Helper()
+	files := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 3; k++ {
+				files[fmt.Sprintf("d%d/s%d/f%d", i, j, k)] = fmt.Sprintf("content %d %d %d", i, j, k)
+			}
+		}
+	}
+	src := t.TempDir()
+	writeTree(t, src, files)
+	return src
+}
+
+//带断点打包src，经过after项后取消，留下断点文件和dest.partial
+func interruptedTar(t *testing.T, src, dest, checkpoint string, after int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	filter := WithFilter(func(string, os.FileInfo) bool {
+		if n++; n == after {
+			cancel()
+		}
+		return true
+	})
+	if err := TarContext(ctx, src, dest, WithCheckpoint(checkpoint, time.Nanosecond), filter); err == nil {
+		t.Fatal("打包没有被取消")
+	}
+	if !FileExists(dest + ".partial") {
+		t.Fatal("没有留下dest.partial")
+	}
+}
+
+//有没有完成的打包时，重新开始的打包返回ErrExist，不会覆盖断点文件和dest.partial
+func TestCheckpointKeepsUnfinished(t *testing.T) {
+	src := checkpointTree(t)
+	out := t.TempDir()
+	dest := filepath.Join(out, "a.tar.gz")
+	checkpoint := filepath.Join(out, "cp.json")
+	interruptedTar(t, src, dest, checkpoint, 40)
+
+	state, _ := os.ReadFile(checkpoint)
+	partial, _ := os.ReadFile(dest + ".partial")
+	if err := TarWithOptions(src, dest, WithCheckpoint(checkpoint, time.Second)); !errors.Is(err, ErrExist) {
+		t.Fatalf("断点文件已经存在时返回了%v", err)
+	}
+	if b, _ := os.ReadFile(checkpoint); !bytes.Equal(b, state) {
+		t.Fatal("断点文件被改动了")
+	}
+	if b, _ := os.ReadFile(dest + ".partial"); !bytes.Equal(b, partial) {
+		t.Fatal("dest.partial被改动了")
+	}
+	if err := ResumeTar(checkpoint, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	//只有dest.partial时也不覆盖它，也不留下新的断点文件
+	other := filepath.Join(out, "b.tar.gz")
+	if err := os.WriteFile(other+".partial", []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := TarWithOptions(src, other, WithCheckpoint(checkpoint, time.Second)); !errors.Is(err, ErrExist) {
+		t.Fatalf("dest.partial已经存在时返回了%v", err)
+	}
+	if b, _ := os.ReadFile(other + ".partial"); string(b) != "keep" {
+		t.Fatal("dest.partial被覆盖了")
+	}
+	if FileExists(checkpoint) {
+		t.Fatal("留下了新的断点文件")
+	}
+}
+
+//dest在要打包的目录下并且已经存在时，带断点打包也不会把它打包进去
+func TestCheckpointSkipsDest(t *testing.T) {
+	src := checkpointTree(t)
+	dest := filepath.Join(src, "backup.tar.gz")
+	checkpoint := filepath.Join(t.TempDir(), "cp.json")
+	for run := 0; run < 2; run++ {
+		if err := TarWithOptions(src, dest, WithOverwrite(), WithCheckpoint(checkpoint, time.Nanosecond)); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range archiveNames(t, dest) {
+			if strings.HasSuffix(name, "backup.tar.gz") || strings.HasSuffix(name, ".partial") {
+				t.Fatalf("第%d次打包包含了自己：%s", run+1, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package targz
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+)
+
+//保存每个文件内容SHA-256的PAX记录，值为十六进制小写
+const checksumPAXKey = "GOUTILS.sha256"
+
+//打包时计算每个普通文件内容的SHA-256，保存在PAX记录GOUTILS.sha256中，解压时可以用WithVerifyChecksums校验
+//需要在写入头之前先读一遍文件，所以每个文件会读取两次；只能用于PAX格式
+func WithChecksums() Option {
+	return func(o *options) error {
+		o.checksums = true
+		return nil
+	}
+}
+
+//解压时校验文件内容的方式
+type VerifyMode int
+
+const (
+	VerifyNone VerifyMode = iota //不校验，默认的方式
+	VerifyFail                   //不一致时删除这个文件，返回包装了ErrChecksumMismatch的*ChecksumError
+	VerifyWarn                   //不一致时保留文件，只记录警告
+)
+
+func (m VerifyMode) String() string {
+	switch m {
+	case VerifyNone:
+		return "VerifyNone"
+	case VerifyFail:
+		return "VerifyFail"
+	case VerifyWarn:
+		return "VerifyWarn"
+	}
+	return "VerifyMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+//解压时按mode校验WithChecksums保存的SHA-256，边写入文件边计算
+//没有这条记录的项（例如其他工具生成的压缩包）不做校验
+func WithVerifyChecksums(mode VerifyMode) Option {
+	return func(o *options) error {
+		if mode < VerifyNone || mode > VerifyWarn {
+			return fmt.Errorf("不支持的校验方式：%v", mode)
+		}
+		o.verifyChecksums = mode
+		return nil
+	}
+}
+
+//文件内容和记录的SHA-256不一致，可以用errors.Is(err, ErrChecksumMismatch)判断
+var ErrChecksumMismatch = errors.New("文件内容和记录的SHA-256不一致")
+
+//VerifyFail时文件内容和记录不一致返回的错误
+type ChecksumError struct {
+	Name string //包内的名称
+	Want string //包中记录的SHA-256
+	Got  string //解压出的内容的SHA-256
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s的内容和记录的SHA-256不一致：记录的是%s，实际是%s", e.Name, e.Want, e.Got)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+//读取文件的内容计算SHA-256，保存到hdr的PAX记录中，只读取hdr.Size字节，和写入包中的内容一致
+func addChecksum(hdr *tar.Header, open func() (io.ReadCloser, error)) error {
+	fr, err := open()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, fr, hdr.Size); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%s在读取时变小了", hdr.Name)
+		}
+		return err
+	}
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	hdr.PAXRecords[checksumPAXKey] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+//需要校验时返回计算摘要的hash.Hash，否则返回nil
+func (u *unpacker) checksumHash(hdr *tar.Header) hash.Hash {
+	if u.opts.verifyChecksums == VerifyNone {
+		return nil
+	}
+	if _, ok := hdr.PAXRecords[checksumPAXKey]; !ok {
+		return nil
+	}
+	return sha256.New()
+}
+
+//文件写入完成后比较摘要，不一致时按VerifyMode删除文件或者记录警告
+func (u *unpacker) verifyChecksum(hdr *tar.Header, h hash.Hash, dstFile string) error {
+	got := hex.EncodeToString(h.Sum(nil))
+	want := hdr.PAXRecords[checksumPAXKey]
+	if got == want {
+		return nil
+	}
+
+	err := &ChecksumError{Name: hdr.Name, Want: want, Got: got}
+	if u.opts.verifyChecksums == VerifyWarn {
+		u.warn(hdr.Name, WarnChecksum, err)
+		return nil
+	}
+	os.Remove(dstFile)
+	return err
+}
@@ -0,0 +1,73 @@
+package targz
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var errCloseFailed = errors.New("close failed")
+
+//Close时返回错误的gzip，模拟结束压缩时写入失败
+type failingCloser struct{}
+
+func (failingCloser) Compress(w io.Writer) (io.WriteCloser, error) {
+	c, err := Gzip.Compress(w)
+	return failingWriter{c}, err
+}
+
+func (failingCloser) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return Gzip.Decompress(r)
+}
+
+func (failingCloser) Extensions() []string {
+	return []string{".tar.fail"}
+}
+
+type failingWriter struct {
+	io.WriteCloser
+}
+
+func (w failingWriter) Close() error {
+	w.WriteCloser.Close()
+	return errCloseFailed
+}
+
+//压缩的写入器Close失败时返回这个错误，不会留下dest
+func TestTarCloseError(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "b/c.txt": "c"})
+
+	for _, direct := range []bool{false, true} {
+		out := t.TempDir()
+		opts := []Option{WithCompressor(failingCloser{})}
+		if direct {
+			opts = append(opts, WithDirectWrite())
+		}
+		if err := TarWithOptions(src, filepath.Join(out, "out.tar.gz"), opts...); !errors.Is(err, errCloseFailed) {
+			t.Fatalf("direct=%v 返回了%v", direct, err)
+		}
+		if names := dirNames(t, out); len(names) != 0 {
+			t.Fatalf("direct=%v 留下了%v", direct, names)
+		}
+	}
+
+	if err := TarToWriter(src, io.Discard, WithCompressor(failingCloser{})); !errors.Is(err, errCloseFailed) {
+		t.Fatalf("TarToWriter返回了%v", err)
+	}
+	if _, err := TarBytes(src, WithCompressor(failingCloser{})); !errors.Is(err, errCloseFailed) {
+		t.Fatalf("TarBytes返回了%v", err)
+	}
+
+	//Close成功时结果正常
+	data, err := TarBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := UnTarToMap(data)
+	if err != nil || !reflect.DeepEqual(files, map[string][]byte{"a.txt": []byte("a"), "b/c.txt": []byte("c")}) {
+		t.Fatalf("%q %v", files, err)
+	}
+}
@@ -0,0 +1,412 @@
+package targz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	bzip2w "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+//压缩包使用的压缩格式
+type Compression int
+
+const (
+	Gzip   Compression = iota //.tar.gz，默认的格式
+	None                      //不压缩，生成普通的.tar，适合内容本身已经压缩过的情况
+	Bzip2                     //.tar.bz2，压缩率比gzip略高，但慢得多
+	Xz                        //.tar.xz，压缩率最高，压缩级别见WithXzPreset
+	Zstd                      //.tar.zst，压缩率接近gzip，速度快得多，见WithZstdLevel、WithZstdConcurrency
+	Lz4                       //.tar.lz4，速度最快，压缩率最低，见WithLz4Level、WithLz4BlockSize
+	Brotli                    //.tar.br，适合通过CDN提供给浏览器，见WithBrotliQuality；没有魔数，解压时按扩展名识别
+)
+
+//一种压缩格式的实现
+type codec struct {
+	name        string
+	ext         string //生成文件时常用的扩展名
+	contentType string //HTTP响应的Content-Type
+	magic       []byte //数据开头的魔数，解压时据此识别格式；没有魔数的格式只能明确指定
+	newWriter   func(w io.Writer, o *options) (io.WriteCloser, error)
+	newReader   func(r io.Reader) (io.ReadCloser, error)
+}
+
+//所有支持的压缩格式，解压时按顺序比较魔数
+var codecs = [...]codec{
+	Gzip: {
+		name:        "gzip",
+		ext:         ".tar.gz",
+		contentType: "application/gzip",
+		magic:       []byte{0x1f, 0x8b},
+		newWriter:   newGzipWriter,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return newGzipReader(r)
+		},
+	},
+	None: {
+		name:        "none",
+		ext:         ".tar",
+		contentType: "application/x-tar",
+		newWriter: func(w io.Writer, o *options) (io.WriteCloser, error) {
+			return nopWriteCloser{w}, nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(r), nil
+		},
+	},
+	Bzip2: {
+		name:        "bzip2",
+		ext:         ".tar.bz2",
+		contentType: "application/x-bzip2",
+		magic:       []byte("BZh"),
+		newWriter: func(w io.Writer, o *options) (io.WriteCloser, error) {
+			//标准库只有bzip2的解压，压缩使用纯Go实现的github.com/dsnet/compress/bzip2
+			return bzip2w.NewWriter(w, nil)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+	Xz: {
+		name:        "xz",
+		ext:         ".tar.xz",
+		contentType: "application/x-xz",
+		magic:       []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		newWriter:   newXzWriter,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(xr), nil
+		},
+	},
+	Zstd: {
+		name:        "zstd",
+		ext:         ".tar.zst",
+		contentType: "application/zstd",
+		magic:       []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newWriter:   newZstdWriter,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+	Lz4: {
+		name:        "lz4",
+		ext:         ".tar.lz4",
+		contentType: "application/x-lz4",
+		magic:       []byte{0x04, 0x22, 0x4d, 0x18},
+		newWriter:   newLz4Writer,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(lz4.NewReader(r)), nil
+		},
+	},
+	Brotli: {
+		name:        "brotli",
+		ext:         ".tar.br",
+		contentType: "application/x-brotli",
+		newWriter: func(w io.Writer, o *options) (io.WriteCloser, error) {
+			return brotli.NewWriterLevel(w, o.brotliQuality), nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(brotli.NewReader(r)), nil
+		},
+	},
+}
+
+func (c Compression) String() string {
+	if c.valid() {
+		return codecs[c].name
+	}
+	return "Compression(" + strconv.Itoa(int(c)) + ")"
+}
+
+func (c Compression) valid() bool {
+	return c >= 0 && int(c) < len(codecs)
+}
+
+//设置打包时使用的压缩格式
+//不设置时，Tar等生成文件的函数根据目标文件的扩展名选择（.tar.gz、.tgz、.tar.bz2、.tar.xz、.tar.zst、.tar.lz4、.tar.br、.tar），
+//无法识别的扩展名返回错误；TarToWriter等没有文件名的函数默认为Gzip；明确设置的格式总是优先于扩展名
+//解压时会根据数据开头的魔数自动识别格式，一般不需要设置；设置为None或者Brotli时不做识别，直接按指定的格式解压
+//Bzip2的压缩级别固定为默认级别；不使用gzip时，WithGzipLevel、WithParallelGzip、WithGzipHeader等gzip的选项不起作用
+func WithCompression(c Compression) Option {
+	return func(o *options) error {
+		if !c.valid() {
+			return fmt.Errorf("不支持的压缩格式：%v", c)
+		}
+		o.compression = c
+		o.compressionSet = true
+		return nil
+	}
+}
+
+//各个扩展名对应的压缩格式，按顺序比较，较长的扩展名在前
+var compressionExts = []struct {
+	ext string
+	c   Compression
+}{
+	{".tar.gz", Gzip}, {".tgz", Gzip},
+	{".tar.bz2", Bzip2}, {".tbz2", Bzip2}, {".tbz", Bzip2},
+	{".tar.xz", Xz}, {".txz", Xz},
+	{".tar.zst", Zstd}, {".tzst", Zstd},
+	{".tar.lz4", Lz4},
+	{".tar.br", Brotli},
+	{".tar", None},
+}
+
+//根据文件的扩展名确定压缩格式，不区分大小写
+func compressionFromExt(name string) (Compression, bool) {
+	lower := strings.ToLower(name)
+	for _, e := range compressionExts {
+		if strings.HasSuffix(lower, e.ext) {
+			return e.c, true
+		}
+	}
+	return Gzip, false
+}
+
+//没有用WithCompression明确指定时，根据要生成的文件的扩展名选择压缩格式，无法识别的扩展名返回错误
+func (o *options) compressionFor(dest string) error {
+	if o.compressionSet {
+		return nil
+	}
+	if c := registeredByExt(dest); c != nil {
+		o.compressor = c
+		return nil
+	}
+	c, ok := compressionFromExt(dest)
+	if !ok {
+		return errors.New("无法根据扩展名确定压缩格式，请使用.tar.gz、.tar.zst等扩展名，或者用WithCompression指定：" + dest)
+	}
+	o.compression = c
+	return nil
+}
+
+//在w上套上o指定的压缩格式，返回的Close只结束压缩，不会关闭w
+func newCompressWriter(w io.Writer, o *options) (io.WriteCloser, error) {
+	if o.compressor != nil {
+		if o.rsyncable {
+			return nil, errors.New("WithRsyncable只能用于gzip格式，不能用于自定义的Compressor")
+		}
+		return o.compressor.Compress(w)
+	}
+	if o.rsyncable && o.compression != Gzip {
+		return nil, fmt.Errorf("WithRsyncable只能用于gzip格式，不能用于%s", codecs[o.compression].name)
+	}
+	return codecs[o.compression].newWriter(w, o)
+}
+
+func newGzipWriter(w io.Writer, o *options) (io.WriteCloser, error) {
+	//默认gzip头中的ModTime保持为0，否则同样的内容每次打包的结果都不同
+	header := o.gzipHeader
+	if o.deterministic {
+		header.ModTime = time.Time{}
+	}
+
+	if o.gzipProcs > 0 {
+		return newParallelGzipWriter(w, o.gzipLevel, o.gzipProcs, header)
+	}
+	if o.rsyncable {
+		return newRsyncableWriter(w, o.gzipLevel, header)
+	}
+	if o.gzipPools != nil {
+		return o.gzipPools.get(w, o.gzipLevel, header)
+	}
+	gw, err := gzip.NewWriterLevel(w, o.gzipLevel)
+	if err != nil {
+		return nil, err
+	}
+	gw.Header = header
+	return gw, nil
+}
+
+//xz命令行各个预设级别使用的字典大小
+var xzDictCaps = [...]int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+//xz默认的预设级别，和xz命令行一致
+const defaultXzPreset = 6
+
+func newXzWriter(w io.Writer, o *options) (io.WriteCloser, error) {
+	conf := xz.WriterConfig{DictCap: xzDictCaps[o.xzPreset]}
+	return conf.NewWriter(w)
+}
+
+//设置xz的预设级别，0到9，和xz -0到xz -9一样，默认为6
+//级别越高字典越大，压缩率越高，压缩和解压占用的内存也越多（级别9约需要几百MB）
+func WithXzPreset(preset int) Option {
+	return func(o *options) error {
+		if preset < 0 || preset >= len(xzDictCaps) {
+			return fmt.Errorf("xz的预设级别必须在0到%d之间：%d", len(xzDictCaps)-1, preset)
+		}
+		o.xzPreset = preset
+		return nil
+	}
+}
+
+//zstd默认的压缩级别，和zstd命令行一致
+const defaultZstdLevel = 3
+
+func newZstdWriter(w io.Writer, o *options) (io.WriteCloser, error) {
+	zopts := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.zstdLevel))}
+	if o.zstdProcs > 0 {
+		zopts = append(zopts, zstd.WithEncoderConcurrency(o.zstdProcs))
+	}
+	return zstd.NewWriter(w, zopts...)
+}
+
+//设置zstd的压缩级别，取值和zstd命令行一样为1到22，默认为3
+//实际只有4档：1为最快，2到5为默认，6到9较好，10以上为最好
+func WithZstdLevel(level int) Option {
+	return func(o *options) error {
+		if level < 1 || level > 22 {
+			return fmt.Errorf("zstd的压缩级别必须在1到22之间：%d", level)
+		}
+		o.zstdLevel = level
+		return nil
+	}
+}
+
+//设置zstd压缩使用的goroutine数，默认为runtime.GOMAXPROCS(0)，设置为1时不使用额外的goroutine
+//并发数不影响压缩的结果
+func WithZstdConcurrency(workers int) Option {
+	return func(o *options) error {
+		if workers <= 0 {
+			return fmt.Errorf("zstd的并发数必须大于0：%d", workers)
+		}
+		o.zstdProcs = workers
+		return nil
+	}
+}
+
+//lz4的各个压缩级别，下标即WithLz4Level的参数，0为最快的Fast
+var lz4Levels = [...]lz4.CompressionLevel{
+	lz4.Fast, lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4,
+	lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+//lz4帧格式支持的块大小
+var lz4BlockSizes = map[int]lz4.BlockSize{
+	64 << 10:  lz4.Block64Kb,
+	256 << 10: lz4.Block256Kb,
+	1 << 20:   lz4.Block1Mb,
+	4 << 20:   lz4.Block4Mb,
+}
+
+func newLz4Writer(w io.Writer, o *options) (io.WriteCloser, error) {
+	lw := lz4.NewWriter(w)
+	lopts := []lz4.Option{lz4.CompressionLevelOption(lz4Levels[o.lz4Level])}
+	if o.lz4BlockSize > 0 {
+		lopts = append(lopts, lz4.BlockSizeOption(lz4BlockSizes[o.lz4BlockSize]))
+	}
+	if err := lw.Apply(lopts...); err != nil {
+		return nil, err
+	}
+	return lw, nil
+}
+
+//设置lz4的压缩级别，0到9，默认为0，即最快的模式；级别越高压缩率越高，但仍然远快于gzip
+func WithLz4Level(level int) Option {
+	return func(o *options) error {
+		if level < 0 || level >= len(lz4Levels) {
+			return fmt.Errorf("lz4的压缩级别必须在0到%d之间：%d", len(lz4Levels)-1, level)
+		}
+		o.lz4Level = level
+		return nil
+	}
+}
+
+//设置lz4帧的块大小，只能是64KB、256KB、1MB或者4MB，默认为4MB
+//块越小占用的内存越少，但压缩率略低
+func WithLz4BlockSize(size int) Option {
+	return func(o *options) error {
+		if _, ok := lz4BlockSizes[size]; !ok {
+			return fmt.Errorf("lz4的块大小只能是64KB、256KB、1MB或者4MB：%d", size)
+		}
+		o.lz4BlockSize = size
+		return nil
+	}
+}
+
+//brotli默认的压缩质量
+const defaultBrotliQuality = 6
+
+//设置brotli的压缩质量，0到11，默认为6；11的压缩率最高，但非常慢，适合一次压缩多次下载的内容
+func WithBrotliQuality(quality int) Option {
+	return func(o *options) error {
+		if quality < brotli.BestSpeed || quality > brotli.BestCompression {
+			return fmt.Errorf("brotli的压缩质量必须在%d到%d之间：%d", brotli.BestSpeed, brotli.BestCompression, quality)
+		}
+		o.brotliQuality = quality
+		return nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+//没有用WithCompression明确指定时，根据要解压的文件的扩展名识别注册的格式和没有魔数的格式（brotli），其他格式根据数据开头的魔数识别
+func (o *options) decompressionFor(src string) {
+	if o.compressionSet {
+		return
+	}
+	if c := registeredByExt(src); c != nil {
+		o.compressor = c
+		return
+	}
+	if c, _ := compressionFromExt(src); c == Brotli {
+		o.compression = Brotli
+	}
+}
+
+//普通tar头中"ustar"魔数的位置
+const ustarMagicOffset = 257
+
+//根据数据开头的魔数识别压缩格式，返回解压后的tar数据
+//无法识别时按gzip处理，这样不是压缩包的数据仍然会得到"不是有效的gzip格式"的错误
+//指定了None、Brotli等没有魔数的格式或者Compressor时不做识别，注册的格式优先于内置的格式
+func newDecompressReader(r io.Reader, o *options) (io.ReadCloser, error) {
+	if o.compressor != nil {
+		return o.compressor.Decompress(r)
+	}
+	if c := codecs[o.compression]; c.magic == nil {
+		return c.newReader(r)
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	magic, _ := br.Peek(ustarMagicOffset + 5)
+	if c := registeredByMagic(magic); c != nil {
+		return c.Decompress(br)
+	}
+	for _, c := range codecs {
+		if c.magic != nil && bytes.HasPrefix(magic, c.magic) {
+			return c.newReader(br)
+		}
+	}
+	if len(magic) == ustarMagicOffset+5 && string(magic[ustarMagicOffset:]) == "ustar" {
+		return codecs[None].newReader(br)
+	}
+	return newGzipReader(br)
+}
@@ -0,0 +1,134 @@
+package targz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+//压缩格式的实现，用于接入本包没有内置的格式，例如自己封装的可随机访问的zstd
+//Compress返回的Close只结束压缩，不能关闭w；Decompress返回的Close不能关闭r
+//Extensions返回这种格式的扩展名（例如".tar.szst"），第一个用于生成文件名，不区分大小写
+//内置的Compression也实现了这个接口，使用各个格式的默认参数，默认的格式为Gzip
+type Compressor interface {
+	Compress(w io.Writer) (io.WriteCloser, error)
+	Decompress(r io.Reader) (io.ReadCloser, error)
+	Extensions() []string
+}
+
+//有魔数的Compressor实现这个接口后，注册后解压时可以根据数据开头自动识别
+type MagicCompressor interface {
+	Compressor
+	Magic() []byte
+}
+
+func (c Compression) Compress(w io.Writer) (io.WriteCloser, error) {
+	o, err := newOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+	o.compression = c
+	return newCompressWriter(w, o)
+}
+
+func (c Compression) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return codecs[c].newReader(r)
+}
+
+func (c Compression) Extensions() []string {
+	var exts []string
+	for _, e := range compressionExts {
+		if e.c == c {
+			exts = append(exts, e.ext)
+		}
+	}
+	return exts
+}
+
+func (c Compression) Magic() []byte {
+	return codecs[c].magic
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   []Compressor //注册的压缩格式，后注册的优先
+)
+
+//注册自定义的压缩格式，之后打包时根据目标文件的扩展名、解压时根据扩展名或者魔数自动选择它
+//注册的格式优先于内置的格式，可以用来替换内置格式的实现；一般在init中调用
+func RegisterCompressor(c Compressor) error {
+	if c == nil {
+		return errors.New("Compressor不能为nil")
+	}
+	if len(c.Extensions()) == 0 {
+		return errors.New("Compressor至少需要一个扩展名")
+	}
+	for _, ext := range c.Extensions() {
+		if !strings.HasPrefix(ext, ".") {
+			return errors.New("扩展名必须以.开头：" + ext)
+		}
+	}
+	compressorsMu.Lock()
+	compressors = append([]Compressor{c}, compressors...)
+	compressorsMu.Unlock()
+	return nil
+}
+
+//打包和解压都使用c，忽略扩展名和魔数；c为内置的Compression时等同于WithCompression
+func WithCompressor(c Compressor) Option {
+	if cc, ok := c.(Compression); ok {
+		return WithCompression(cc)
+	}
+	return func(o *options) error {
+		if c == nil {
+			return errors.New("Compressor不能为nil")
+		}
+		o.compressor = c
+		o.compressionSet = true
+		return nil
+	}
+}
+
+//根据文件的扩展名查找注册的压缩格式，不区分大小写
+func registeredByExt(name string) Compressor {
+	lower := strings.ToLower(name)
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	for _, c := range compressors {
+		for _, ext := range c.Extensions() {
+			if strings.HasSuffix(lower, strings.ToLower(ext)) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+//根据数据开头的魔数查找注册的压缩格式
+func registeredByMagic(data []byte) Compressor {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	for _, c := range compressors {
+		if mc, ok := c.(MagicCompressor); ok {
+			if magic := mc.Magic(); len(magic) > 0 && bytes.HasPrefix(data, magic) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+//生成文件时使用的扩展名和HTTP响应的Content-Type
+func (o *options) archiveType() (ext string, contentType string) {
+	if o.compressor != nil {
+		ext = ".tar"
+		if exts := o.compressor.Extensions(); len(exts) > 0 {
+			ext = exts[0]
+		}
+		return ext, "application/octet-stream"
+	}
+	c := codecs[o.compression]
+	return c.ext, c.contentType
+}
@@ -0,0 +1,33 @@
+package targz
+
+import (
+	"context"
+	"io"
+)
+
+//每次写入前检查ctx是否已经取消，用于中断单个大文件的复制
+//io.Copy每次最多写入32KB，所以取消后最多再处理这么多数据
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+//每次读取前检查ctx是否已经取消
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
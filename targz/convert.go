@@ -0,0 +1,134 @@
+package targz
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//把.zip文件转换为.tar.gz文件，逐项从zip中读取并直接写入tar，不会在内存中缓存整个文件，也不会解压到磁盘
+//名称、大小、权限和修改时间保持不变，目录的名称以`/`结尾
+//dest的压缩格式和Tar一样根据扩展名选择，也可以用WithCompression指定；dest已存在时按WithOverwriteMode处理
+func ConvertZipToTarGz(src string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+
+	tw, closeTw, err := newTarGzWriter(d.f, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if er := closeTw(); er != nil && err == nil {
+			err = er
+		}
+	}()
+
+	for _, f := range zr.File {
+		if err := zipEntryToTar(f, tw, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//把zip中的一项写入tw
+func zipEntryToTar(f *zip.File, tw *tar.Writer, o *options) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	fi := f.FileInfo()
+	link := ""
+	if fi.Mode()&os.ModeSymlink != 0 {
+		//符号链接的内容是链接的目标
+		target, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		link = string(target)
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = f.Name
+	hdr.Format = o.format
+	if fi.IsDir() && !strings.HasSuffix(hdr.Name, "/") {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		if _, err := io.Copy(tw, rc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//把.tar.gz文件转换为.zip文件，逐项从tar中读取并直接写入zip，不会在内存中缓存整个文件，也不会解压到磁盘
+//src可以是UnTar支持的任意压缩格式；名称、大小、权限和修改时间保持不变
+//zip无法表示的设备文件和命名管道会被跳过，硬链接无法在不缓存内容的情况下转换，遇到时返回错误
+func ConvertTarGzToZip(src string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	o.decompressionFor(src)
+
+	fr, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	gr, err := newDecompressReader(fr, o)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+
+	zw := zip.NewWriter(d.f)
+	defer func() {
+		if er := zw.Close(); er != nil && err == nil {
+			err = er
+		}
+	}()
+
+	return tarToZip(tar.NewReader(gr), zw)
+}
@@ -0,0 +1,127 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+//内容相同的文件只打包第一个，之后的记录为指向它的TypeLink，解压时和硬链接一样处理
+//先按大小筛选，只有出现同样大小的文件时才计算SHA-256比较内容，适合包含大量重复大文件的目录
+//重复的文件和第一个文件共用权限、修改时间等属性；不想在解压时得到硬链接可以使用WithHardLinksAsCopies
+//空文件不处理；打包为zip时不起作用
+func WithDedupe() Option {
+	return func(o *options) error {
+		o.dedupe = true
+		return nil
+	}
+}
+
+//解压时把硬链接解压为独立的文件，复制链接目标的内容和权限，适合不支持或者不希望出现硬链接的文件系统
+func WithHardLinksAsCopies() Option {
+	return func(o *options) error {
+		o.linksAsCopies = true
+		return nil
+	}
+}
+
+//WithDedupe时已经打包的一个文件
+type dedupeFile struct {
+	name    string    //包内的名称
+	path    string    //磁盘上的路径，需要比较时重新读取
+	modTime time.Time //打包时的修改时间，重新读取时不同说明已经改变，不再用于比较
+	sum     []byte    //内容的SHA-256，需要比较时才计算，无法计算时为空
+	hashed  bool
+}
+
+//在已经打包的同样大小的文件中查找内容和fr相同的，找到时返回它的包内名称
+//没有找到时返回表示fr的dedupeFile，写入成功后由addDedupe记录；fr读取之后回到开头
+func (p *packer) findDuplicate(fr *os.File, srcFull string, hdr *tar.Header, modTime time.Time) (string, *dedupeFile, error) {
+	self := &dedupeFile{name: hdr.Name, path: srcFull, modTime: modTime}
+	cands := p.dupes[hdr.Size]
+	if len(cands) == 0 {
+		return "", self, nil
+	}
+
+	sum, err := p.hashContent(fr)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := fr.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	self.sum, self.hashed = sum, true
+
+	for _, c := range cands {
+		if !c.hashed {
+			c.sum, c.hashed = p.hashDedupeFile(c, hdr.Size), true
+		}
+		if len(c.sum) > 0 && bytes.Equal(c.sum, sum) {
+			return c.name, nil, nil
+		}
+	}
+	return "", self, nil
+}
+
+//记录已经写入的文件，之后同样大小的文件和它比较
+func (p *packer) addDedupe(f *dedupeFile, size int64) {
+	if p.dupes == nil {
+		p.dupes = make(map[int64][]*dedupeFile)
+	}
+	p.dupes[size] = append(p.dupes[size], f)
+}
+
+//重新读取已经打包的文件计算SHA-256，文件已经改变或者无法读取时返回nil，不再用于比较
+func (p *packer) hashDedupeFile(f *dedupeFile, size int64) []byte {
+	fi, err := os.Stat(f.path)
+	if err != nil || fi.Size() != size || !fi.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	fr, err := os.Open(f.path)
+	if err != nil {
+		return nil
+	}
+	defer fr.Close()
+	sum, err := p.hashContent(fr)
+	if err != nil {
+		return nil
+	}
+	return sum
+}
+
+func (p *packer) hashContent(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := copyBuffer(h, r, p.opts.bufferSize); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+//WithHardLinksAsCopies时把硬链接的目标复制为dstFile
+func (u *unpacker) copyLinkTarget(name string, dstFile string, target string) error {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	//已存在的文件可能是指向target的硬链接，直接写入会把target也清空
+	if old, err := os.Lstat(dstFile); err == nil && !old.IsDir() {
+		if err := os.Remove(dstFile); err != nil {
+			return err
+		}
+	}
+	fr, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+	//复制出的文件同样计入WithMaxExtractSize，避免用大量硬链接放大
+	if err := unTarFile(dstFile, u.limitReader(name, fr), u.opts.bufferSize); err != nil {
+		removeOverLimit(dstFile, err)
+		return err
+	}
+	os.Chmod(dstFile, fi.Mode().Perm())
+	return os.Chtimes(dstFile, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,59 @@
+package targz
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//同样的目录树，创建顺序和时间不同，WithDeterministic打包得到的字节也完全相同
+func TestDeterministicBytes(t *testing.T) {
+	names := []string{"b/2.txt", "a.txt", "b/1.txt", "c/d/e.txt", "z.txt"}
+	build := func(order []string, mtime time.Time) string {
+		src := filepath.Join(t.TempDir(), "src")
+		for _, name := range order {
+			writeTree(t, src, map[string]string{name: "content of " + name})
+		}
+		err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, mtime, mtime)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+	reversed := make([]string, len(names))
+	for i, name := range names {
+		reversed[len(names)-1-i] = name
+	}
+	srcs := []string{
+		build(names, time.Now().Add(-time.Hour)),
+		build(reversed, time.Now().Add(time.Hour)),
+	}
+
+	for _, opts := range [][]Option{
+		{WithDeterministic()},
+		{WithDeterministicTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), WithKeepBaseDir()},
+	} {
+		var outputs [][]byte
+		for _, src := range srcs {
+			dest := filepath.Join(t.TempDir(), "out.tar.gz")
+			if err := TarWithOptions(src, dest, opts...); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, data)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Fatal("两次打包的结果不同")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package targz
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//解压srcTar，计算其中未压缩的tar流的SHA-256，返回十六进制的字符串，压缩格式的识别和UnTar相同
+//和打包时WithStats得到的Stats.ContentDigest计算方法相同：同样的内容用不同的格式和级别压缩，结果相同，
+//配合WithDeterministic可以得到和压缩方式无关的稳定标识；多成员的gzip（例如WithCheckpoint生成的）按拼接后的内容计算
+func TarContentDigest(srcTar string, opts ...Option) (string, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	srcTar = filepath.FromSlash(srcTar)
+	o.decompressionFor(srcTar)
+	if !Exists(srcTar) {
+		return "", errors.New("要计算的文件不存在：" + srcTar)
+	}
+
+	fr, err := os.Open(srcTar)
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+
+	gr, err := newDecompressReader(fr, o)
+	if err != nil {
+		return "", err
+	}
+	defer gr.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, gr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//在写入压缩之前计算tar流的摘要
+type digestWriter struct {
+	io.WriteCloser
+	h hash.Hash
+}
+
+func (w *digestWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.h.Write(p[:n])
+	return n, err
+}
+
+//压缩器支持Flush时转发给它，见ratioTracker
+func (w *digestWriter) Flush() error {
+	if f, ok := w.WriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package targz
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+//保存转换前的原始文件名的PAX记录，值为原始字节的base64
+const rawNamePAXKey = "GOUTILS.rawname"
+
+//打包时把不是UTF-8的文件名按enc解码为UTF-8再写入tar头，例如旧的Windows工具生成的GBK文件名（simplifiedchinese.GBK）
+//已经是有效UTF-8的名称保持不变；转换过的名称把原始字节保存在PAX记录GOUTILS.rawname中，解压时可以用WithRawNames还原
+//无法解码的字节替换为%XX并记录警告，不会中断打包；只能用于PAX格式，依赖golang.org/x/text/encoding
+func WithSourceEncoding(enc encoding.Encoding) Option {
+	return func(o *options) error {
+		if enc == nil {
+			return errors.New("WithSourceEncoding的enc不能为nil")
+		}
+		o.sourceEncoding = enc
+		return nil
+	}
+}
+
+//解压时有GOUTILS.rawname记录的项使用其中的原始字节作为文件名，还原WithSourceEncoding转换之前的名称
+func WithRawNames() Option {
+	return func(o *options) error {
+		o.rawNames = true
+		return nil
+	}
+}
+
+//按WithSourceEncoding把hdr中不是UTF-8的名称和链接目标转换为UTF-8
+func (p *packer) decodeName(hdr *tar.Header) {
+	if utf8.ValidString(hdr.Name) {
+		return
+	}
+	raw := hdr.Name
+	hdr.Name = p.decodeString(raw)
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	hdr.PAXRecords[rawNamePAXKey] = base64.StdEncoding.EncodeToString([]byte(raw))
+
+	if hdr.Linkname != "" && !utf8.ValidString(hdr.Linkname) {
+		hdr.Linkname = p.decodeString(hdr.Linkname)
+	}
+}
+
+//解码s，失败或者结果仍然不是UTF-8时把无效的字节替换为%XX，并记录警告
+func (p *packer) decodeString(s string) string {
+	decoded, err := p.opts.sourceEncoding.NewDecoder().String(s)
+	if err == nil && utf8.ValidString(decoded) {
+		return decoded
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size <= 1 {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+			i++
+			continue
+		}
+		b.WriteString(s[i : i+size])
+		i += size
+	}
+	p.warn(b.String(), WarnEncoding, fmt.Errorf("文件名无法按指定的编码转换为UTF-8，无效的字节已替换为%%XX：%v", err))
+	return b.String()
+}
+
+//WithRawNames时用GOUTILS.rawname记录的原始字节替换hdr.Name
+func (u *unpacker) rawName(hdr *tar.Header) {
+	if !u.opts.rawNames {
+		return
+	}
+	v, ok := hdr.PAXRecords[rawNamePAXKey]
+	if !ok {
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		u.warn(hdr.Name, WarnEncoding, fmt.Errorf("无效的%s记录：%w", rawNamePAXKey, err))
+		return
+	}
+	hdr.Name = string(raw)
+}
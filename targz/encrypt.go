@@ -0,0 +1,318 @@
+package targz
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+//加密格式的头部依次为：魔数"TGZE"、版本、scrypt的log2(N)、r、p各1字节，16字节的盐，7字节的nonce前缀，32字节的口令校验值
+//之后是若干块，每块是最多64KB明文的AES-256-GCM密文，nonce为前缀、4字节的块序号和1字节的最后一块标记，
+//头部作为每一块的附加数据，所以改动头部、调换、删除或者截断块都能被发现
+const (
+	encMagic      = "TGZE"
+	encVersion    = 1
+	encSaltSize   = 16
+	encPrefixSize = 7
+	encCheckSize  = sha256.Size
+	encHeaderSize = len(encMagic) + 4 + encSaltSize + encPrefixSize + encCheckSize
+	encChunkSize  = 64 << 10
+
+	//scrypt的参数，保存在头部，以后可以调整而不影响旧的文件
+	encLogN = 15
+	encR    = 8
+	encP    = 1
+)
+
+//解密时口令错误返回的错误，此时还没有解压任何文件
+var ErrWrongPassphrase = errors.New("口令错误")
+
+//密文被截断或者篡改时返回的错误
+var ErrCorrupted = errors.New("加密的数据已损坏或者被篡改")
+
+//将文件或者目录打包、压缩后用passphrase加密，写入dest
+//密钥由scrypt从口令派生，数据按64KB分块用AES-256-GCM加密，可以流式处理任意大小的压缩包
+//dest可以在压缩格式的扩展名后加上.enc，例如backup.tar.gz.enc，压缩格式按去掉.enc后的扩展名选择
+func TarEncrypted(src string, dest string, passphrase string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return errors.New("口令不能为空")
+	}
+	if err := o.compressionFor(strings.TrimSuffix(dest, ".enc")); err != nil {
+		return err
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+
+	ew, err := newEncryptWriter(d.f, passphrase)
+	if err != nil {
+		return err
+	}
+	err = tarToWriter(context.Background(), ew, o, func(p *packer) error {
+		return p.tarSrc(src)
+	})
+	if err != nil && !isPartial(err) {
+		return err
+	}
+	//写出最后一块
+	if cerr := ew.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+//解密TarEncrypted生成的文件并解压到dstDir文件夹下
+//口令错误时在解压任何文件之前返回ErrWrongPassphrase；数据被截断或者篡改时返回ErrCorrupted，
+//此时已经解压出的文件都是校验通过的内容，不会写入未经校验的数据
+func UnTarEncrypted(srcTar string, dstDir string, passphrase string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	o.decompressionFor(strings.TrimSuffix(srcTar, ".enc"))
+
+	fr, err := os.Open(srcTar)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	dr, err := newDecryptReader(fr, passphrase)
+	if err != nil {
+		return err
+	}
+	err = unTarFromReader(context.Background(), dr, dstDir, o)
+	if err != nil && !isPartial(err) {
+		return err
+	}
+	//tar的结束块之后可能还有没有读取的块，同样要校验，才能发现结尾被截断或者篡改
+	if _, derr := io.Copy(ioutil.Discard, dr); derr != nil {
+		return derr
+	}
+	return err
+}
+
+//从口令派生加密的密钥和口令校验值
+func deriveKey(passphrase string, salt []byte, logN, r, p int) (key []byte, check []byte, err error) {
+	dk, err := scrypt.Key([]byte(passphrase), salt, 1<<uint(logN), r, p, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(dk[32:])
+	return dk[:32], sum[:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//分块加密的io.WriteCloser，Close写出最后一块，但不会关闭底层的w
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	seq    uint32
+	buf    []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, encSaltSize+encPrefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, check, err := deriveKey(passphrase, salt[:encSaltSize], encLogN, encR, encP)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, encHeaderSize)
+	header = append(header, encMagic...)
+	header = append(header, encVersion, encLogN, encR, encP)
+	header = append(header, salt...)
+	header = append(header, check...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: salt[encSaltSize:],
+		buf:    make([]byte, 0, encChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		//缓冲区满了且还有数据时才写出，保证最后一块留到Close时写出
+		if len(e.buf) == encChunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	nonce := chunkNonce(e.prefix, e.seq, last)
+	e.seq++
+	_, err := e.w.Write(e.aead.Seal(nil, nonce, e.buf, e.header))
+	e.buf = e.buf[:0]
+	return err
+}
+
+//每一块的nonce：前缀 | 块序号 | 是否最后一块
+func chunkNonce(prefix []byte, seq uint32, last bool) []byte {
+	nonce := make([]byte, 0, encPrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, seq)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+//分块解密的io.Reader，只返回校验通过的数据
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	seq    uint32
+	chunk  []byte
+	plain  []byte //当前块中还没有读出的明文
+	done   bool   //已经读完最后一块
+}
+
+//读取并检查头部，口令错误时返回ErrWrongPassphrase
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w：头部不完整", ErrCorrupted)
+	}
+	if string(header[:len(encMagic)]) != encMagic {
+		return nil, errors.New("不是TarEncrypted生成的加密文件")
+	}
+	pos := len(encMagic)
+	if v := header[pos]; v != encVersion {
+		return nil, fmt.Errorf("不支持的加密格式版本：%d", v)
+	}
+	logN, cr, cp := int(header[pos+1]), int(header[pos+2]), int(header[pos+3])
+	//限制参数，避免被篡改的头部消耗大量内存
+	if logN < 10 || logN > 22 || cr < 1 || cr > 32 || cp < 1 || cp > 16 {
+		return nil, fmt.Errorf("%w：scrypt参数不合法", ErrCorrupted)
+	}
+	pos += 4
+	salt := header[pos : pos+encSaltSize]
+	prefix := header[pos+encSaltSize : pos+encSaltSize+encPrefixSize]
+	check := header[pos+encSaltSize+encPrefixSize:]
+
+	key, want, err := deriveKey(passphrase, salt, logN, cr, cp)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(check, want) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, encChunkSize+aead.Overhead()+1),
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		chunk:  make([]byte, encChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+//读取并解密下一块
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return fmt.Errorf("%w：缺少最后一块", ErrCorrupted)
+		}
+		return err
+	}
+	//之后没有数据了，这一块必须是最后一块
+	//其他读取错误不能当作后面还有数据，否则会按错误的nonce解密，把读取错误报告为校验失败
+	_, peekErr := d.r.Peek(1)
+	if peekErr != nil && peekErr != io.EOF {
+		return peekErr
+	}
+	last := peekErr == io.EOF
+
+	plain, err := d.aead.Open(d.chunk[:0], chunkNonce(d.prefix, d.seq, last), d.chunk[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w：第%d块校验失败", ErrCorrupted, d.seq)
+	}
+	d.seq++
+	d.plain = plain
+	d.done = last
+	return nil
+}
@@ -0,0 +1,51 @@
+package targz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+var errReadFailed = errors.New("read failed")
+
+//读完所有数据之后返回errReadFailed，而不是io.EOF
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errReadFailed
+}
+
+//最后一块之后的读取错误原样返回，不会报告为ErrCorrupted
+func TestDecryptReadError(t *testing.T) {
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//正好一整块，读完最后一块时还不知道后面是否有数据
+	plain := bytes.Repeat([]byte("x"), encChunkSize)
+	if _, err := ew.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+
+	dr, err := newDecryptReader(bytes.NewReader(ciphertext), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(dr); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("解密失败：%v", err)
+	}
+
+	dr, err = newDecryptReader(io.MultiReader(bytes.NewReader(ciphertext), failingReader{}), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(dr); !errors.Is(err, errReadFailed) || errors.Is(err, ErrCorrupted) {
+		t.Fatalf("返回了%v", err)
+	}
+}
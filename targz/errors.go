@@ -0,0 +1,114 @@
+package targz
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//打包和解压时遇到某一项出错的处理方式
+type ErrorPolicy int
+
+const (
+	FailFast        ErrorPolicy = iota //立即停止并返回错误，默认的方式
+	ContinueOnError                    //跳过出错的项继续处理，结束时返回*MultiError
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case FailFast:
+		return "FailFast"
+	case ContinueOnError:
+		return "ContinueOnError"
+	}
+	return "ErrorPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+//设置某一项出错时的处理方式，例如无法读取的文件、解压时无法创建的文件
+//ContinueOnError时出错的项被跳过，其他的项照常处理，结束时返回包含每一项错误的*MultiError，
+//此时压缩包或者解压的结果仍然保留；写入压缩包失败、取消等无法继续的错误仍然立即返回
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(o *options) error {
+		if policy != FailFast && policy != ContinueOnError {
+			return fmt.Errorf("不支持的错误处理方式：%v", policy)
+		}
+		o.errorPolicy = policy
+		return nil
+	}
+}
+
+//某一项出错的原因
+type EntryError struct {
+	Name string //包内的名称
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	return e.Name + "：" + e.Err.Error()
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+//ContinueOnError时有项出错，结束后返回的错误，errors.Is、errors.As会检查其中的每一个错误
+type MultiError struct {
+	Errors []*EntryError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d项出错：%s", len(e.Errors), strings.Join(msgs, "；"))
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+//是否是ContinueOnError时部分项出错，此时结果仍然可用
+func isPartial(err error) bool {
+	var me *MultiError
+	return errors.As(err, &me)
+}
+
+//没有项出错时返回nil
+func multiError(errs []*EntryError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: errs}
+}
+
+//打包某一项出错，ContinueOnError且压缩包仍然完整时记下错误并返回nil，否则原样返回
+func (p *packer) entryFailed(name string, err error) error {
+	if err == nil || p.opts.errorPolicy != ContinueOnError || p.broken || p.ctx.Err() != nil {
+		return err
+	}
+	p.errs = append(p.errs, &EntryError{Name: name, Err: err})
+	p.stats.Errors++
+	logEntryError(p.opts, name, err)
+	return nil
+}
+
+//解压某一项出错，ContinueOnError时记下错误并返回nil，否则原样返回
+func (u *unpacker) entryFailed(name string, err error) error {
+	if err == nil || u.opts.errorPolicy != ContinueOnError || u.ctx.Err() != nil {
+		return err
+	}
+	//超出解压的限制时总是停止
+	var le *ExtractLimitError
+	if errors.As(err, &le) {
+		return err
+	}
+	u.errs = append(u.errs, &EntryError{Name: name, Err: err})
+	logEntryError(u.opts, name, err)
+	return nil
+}
@@ -0,0 +1,110 @@
+package targz
+
+import (
+	"path"
+	"strings"
+)
+
+//打包时跳过与patterns匹配的文件和目录，匹配的目录不会再遍历其下的内容
+//匹配的对象是包内以`/`分隔的相对路径（即hdr.Name去掉目录末尾的`/`），语法同path.Match，另外支持：
+//  不含`/`的模式匹配任意层级的文件名，例如`*.log`
+//  `**`匹配零个或者多个层级，例如`node_modules/**`、`**/tmp/*`
+//没有匹配到任何文件的模式不算错误，语法错误的模式会在打包开始前返回path.ErrBadPattern
+func WithExclude(patterns ...string) Option {
+	return func(o *options) error {
+		for _, pattern := range patterns {
+			if err := checkPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.excludes = append(o.excludes, patterns...)
+		return nil
+	}
+}
+
+//版本控制系统的目录，和GNU tar的--exclude-vcs一致
+var vcsDirs = []string{".git", ".svn", ".hg", ".bzr", "_darcs", "CVS", "RCS", "SCCS", ".arch-ids", "{arch}"}
+
+//版本控制系统的元数据文件
+var vcsFiles = []string{".gitignore", ".gitattributes", ".gitmodules", ".hgignore", ".hgtags", ".bzrignore", ".bzrtags", ".cvsignore"}
+
+//打包时跳过任意层级中版本控制系统的目录，例如.git、.svn、.hg、.bzr，和WithExclude、WithFilter可以同时使用
+//git的子模块和工作树中.git是一个文件，同样会被跳过
+func WithExcludeVCS() Option {
+	return func(o *options) error {
+		o.excludes = append(o.excludes, vcsDirs...)
+		return nil
+	}
+}
+
+//打包时跳过版本控制系统的元数据文件，例如.gitignore、.gitattributes、.gitmodules、.hgignore，通常和WithExcludeVCS一起使用
+func WithExcludeVCSFiles() Option {
+	return func(o *options) error {
+		o.excludes = append(o.excludes, vcsFiles...)
+		return nil
+	}
+}
+
+//检查模式的语法是否正确
+func checkPattern(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//判断包内的相对路径name是否与某一个排除模式匹配
+func matchAny(patterns []string, name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range patterns {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//判断name是否与pattern匹配，name是以`/`分隔的相对路径
+func matchPattern(pattern string, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		//不含`/`的模式只和文件名比较
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+//逐层比较，`**`可以匹配零个或者多个层级
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			//去掉连续的`**`
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
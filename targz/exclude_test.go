@@ -0,0 +1,55 @@
+package targz
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//按Plan列出的包内名称，按字典序排列
+func planNames(t *testing.T, src string, opts ...Option) []string {
+	t.Helper()
+	entries, err := Plan(src, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//WithExcludeVCS跳过任意层级的版本控制目录，和WithExclude、WithFilter同时生效
+func TestExcludeVCS(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		".git/HEAD":           "ref: refs/heads/master",
+		".git/objects/ab/cd":  "blob",
+		".gitmodules":         "[submodule]",
+		"main.go":             "package main",
+		"debug.log":           "log",
+		"tmp/x.go":            "package tmp",
+		"vendor/lib/.hg/tags": "tags",
+		"vendor/lib/.git":     "gitdir: ../../.git/modules/lib",
+		"vendor/lib/lib.go":   "package lib",
+	})
+	filter := WithFilter(func(name string, fi os.FileInfo) bool {
+		return !strings.HasPrefix(name, "tmp")
+	})
+
+	got := planNames(t, src, WithExcludeVCS(), WithExclude("*.log"), filter)
+	want := []string{".gitmodules", "main.go", "vendor/", "vendor/lib/", "vendor/lib/lib.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("WithExcludeVCS：%v，应为%v", got, want)
+	}
+
+	got = planNames(t, src, WithExcludeVCS(), WithExcludeVCSFiles())
+	want = []string{"debug.log", "main.go", "tmp/", "tmp/x.go", "vendor/", "vendor/lib/", "vendor/lib/lib.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("WithExcludeVCSFiles：%v，应为%v", got, want)
+	}
+}
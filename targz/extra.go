@@ -0,0 +1,121 @@
+package targz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//通过WithExtraEntry加入的、不在磁盘上的文件
+type extraEntry struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	r       io.Reader
+	data    []byte //第一次使用时从r中读出的内容，Plan和打包可以共用
+	loaded  bool
+}
+
+//读出r中的全部内容，只读取一次
+func (e *extraEntry) content() ([]byte, error) {
+	if !e.loaded {
+		data, err := ioutil.ReadAll(e.r)
+		if err != nil {
+			return nil, fmt.Errorf("读取额外的项%s失败：%w", e.name, err)
+		}
+		e.data, e.loaded = data, true
+	}
+	return e.data, nil
+}
+
+//在遍历的目录树之后写入一个普通文件，内容从r中读取，例如生成的VERSION文件、渲染后的配置
+//name是以`/`分隔的包内名称，不能是绝对路径，也不能包含`..`；mode只使用其中的权限位
+//可以多次使用，按设置的顺序写入；r会被完整读入内存以得到文件大小，所以只适合较小的内容
+//name和遍历到的文件、目录或者另一个额外的项同名时返回错误
+func WithExtraEntry(name string, mode os.FileMode, modTime time.Time, r io.Reader) Option {
+	return func(o *options) error {
+		if r == nil {
+			return errors.New("额外的项没有提供内容：" + name)
+		}
+		clean, ok := cleanEntryName(name)
+		if !ok {
+			return errors.New("额外的项的名称不合法：" + name)
+		}
+		for _, e := range o.extras {
+			if e.name == clean {
+				return errors.New("额外的项重名：" + clean)
+			}
+		}
+
+		o.extras = append(o.extras, &extraEntry{
+			name:    clean,
+			mode:    mode.Perm(),
+			modTime: modTime,
+			r:       r,
+		})
+		return nil
+	}
+}
+
+//清理以`/`分隔的包内名称，名称为空、是绝对路径或者超出了包的根目录时返回false
+func cleanEntryName(name string) (string, bool) {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
+
+//写入所有额外的项和增量打包时被删除的项的列表，必须在遍历完成之后调用，才能发现和遍历到的项同名
+func (p *packer) tarExtras() error {
+	for _, e := range p.opts.extras {
+		if p.names[e.name] || p.names[e.name+"/"] {
+			return fmt.Errorf("额外的项和打包的文件同名：%s", e.name)
+		}
+		if err := p.tarExtra(e); err != nil {
+			return err
+		}
+	}
+	return p.tarDeleted()
+}
+
+//写入一个额外的项
+func (p *packer) tarExtra(e *extraEntry) error {
+	data, err := e.content()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := p.header(extraFileInfo{e: e, size: int64(len(data))}, e.name, "")
+	if err != nil {
+		return err
+	}
+	//额外的项使用明确指定的名称，不受WithStripPrefix、WithAddPrefix影响
+	hdr.Name = e.name
+	if err := p.writeHeader(hdr); err != nil {
+		return err
+	}
+	if p.dryRun {
+		return nil
+	}
+	return p.copyFile(bytes.NewReader(data), hdr.Size)
+}
+
+//为额外的项生成tar头时使用的os.FileInfo
+type extraFileInfo struct {
+	e    *extraEntry
+	size int64
+}
+
+func (fi extraFileInfo) Name() string       { return path.Base(fi.e.name) }
+func (fi extraFileInfo) Size() int64        { return fi.size }
+func (fi extraFileInfo) Mode() os.FileMode  { return fi.e.mode }
+func (fi extraFileInfo) ModTime() time.Time { return fi.e.modTime }
+func (fi extraFileInfo) IsDir() bool        { return false }
+func (fi extraFileInfo) Sys() interface{}   { return nil }
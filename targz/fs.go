@@ -0,0 +1,179 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+//fs.FS没有提供权限时使用的默认权限
+const (
+	defaultFileMode fs.FileMode = 0644
+	defaultDirMode  fs.FileMode = 0755
+)
+
+//将fsys中root目录下的所有内容打成.tar.gz的数据流，写入到w中，例如embed.FS、fstest.MapFS
+//root是fsys中以`/`分隔的目录，"."表示整个fsys，包内的名称相对于root
+//和Tar一样支持排除模式、过滤函数等选项；没有提供权限的文件和目录分别按0644和0755打包，
+//fs.FS不一定能读取符号链接本身，所以符号链接按指向的内容打包，无法读取时跳过并记录警告
+func TarFS(fsys fs.FS, root string, w io.Writer, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	if !fs.ValidPath(root) {
+		return errors.New("fs.FS中的路径不合法：" + root)
+	}
+	if _, err := fs.Stat(fsys, root); err != nil {
+		return err
+	}
+
+	return tarToWriter(context.Background(), w, o, func(p *packer) error {
+		return p.tarFS(fsys, root)
+	})
+}
+
+//用fs.WalkDir遍历fsys，目录在其下的内容之前写入
+func (p *packer) tarFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			//读取目录失败时跳过这个目录
+			return p.entryFailed(name, err)
+		}
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+
+		//root是文件时以文件名打包
+		if name == root && !d.IsDir() {
+			p.srcRoot = path.Base(name)
+			return p.tarFSFile(fsys, name, path.Base(name))
+		}
+
+		rel := name
+		if root != "." {
+			rel = strings.TrimPrefix(name, root+"/")
+		}
+
+		readIgnore := func(ignore string) ([]byte, error) {
+			return fs.ReadFile(fsys, path.Join(name, ignore))
+		}
+		if name != root {
+			p.trimIgnores(rel)
+		}
+
+		if d.IsDir() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fi = fsFileInfo{fi}
+
+			//root本身只有设置了WithRootEntry时才写入
+			entry := rootEntryName
+			if name == root {
+				p.pushIgnores("", readIgnore)
+				if !p.opts.rootEntry {
+					return nil
+				}
+			} else {
+				if p.skip(rel, fi) {
+					return fs.SkipDir
+				}
+				p.pushIgnores(rel, readIgnore)
+				entry = rel + "/"
+			}
+
+			//超过WithMaxDepth的目录只写入目录本身
+			if name != root && p.opts.maxDepth >= 0 && strings.Count(rel, "/") >= p.opts.maxDepth {
+				p.stats.DepthPruned++
+				logSkip(p.opts, rel, "depth")
+				hdr, err := p.header(fi, entry, "")
+				if err != nil {
+					return err
+				}
+				if err := p.writeHeader(hdr); err != nil {
+					return err
+				}
+				return fs.SkipDir
+			}
+
+			hdr, err := p.header(fi, entry, "")
+			if err != nil {
+				return err
+			}
+			return p.writeHeader(hdr)
+		}
+		return p.entryFailed(rel, p.tarFSFile(fsys, name, rel))
+	})
+}
+
+//打包fsys中的一个文件，rel是包内的名称
+func (p *packer) tarFSFile(fsys fs.FS, name string, rel string) error {
+	//fs.Stat会跟随符号链接
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		p.warn(rel, WarnUnreadable, err)
+		return nil
+	}
+	fi = fsFileInfo{fi}
+
+	if p.skip(rel, fi) {
+		return nil
+	}
+	if !fi.Mode().IsRegular() {
+		p.warn(rel, WarnUnsupported, errors.New("不是普通文件，已跳过"))
+		return nil
+	}
+
+	hdr, err := p.header(fi, rel, "")
+	if err != nil {
+		return err
+	}
+	if p.dryRun {
+		return p.writeHeader(hdr)
+	}
+
+	//先打开文件再写入头，文件已被删除时跳过
+	fr, err := fsys.Open(name)
+	if err != nil {
+		if p.vanished(rel, err) {
+			return nil
+		}
+		return err
+	}
+	defer fr.Close()
+
+	if p.opts.checksums {
+		err := addChecksum(hdr, func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := p.writeHeader(hdr); err != nil {
+		return err
+	}
+	return p.copyFile(fr, hdr.Size)
+}
+
+//没有提供权限时补上默认权限
+type fsFileInfo struct {
+	fs.FileInfo
+}
+
+func (fi fsFileInfo) Mode() fs.FileMode {
+	mode := fi.FileInfo.Mode()
+	if mode.Perm() != 0 {
+		return mode
+	}
+	if mode.IsDir() {
+		return mode | defaultDirMode
+	}
+	return mode | defaultFileMode
+}
@@ -0,0 +1,76 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+//读取.tar.gz数据中的所有tar头，键是包内的名称
+func tarHeaders(t *testing.T, data []byte) map[string]*tar.Header {
+	t.Helper()
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[hdr.Name] = hdr
+	}
+}
+
+//TarFS按Tar的排除规则打包fs.FS，没有提供权限的文件和目录使用默认权限
+func TestTarFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/c.txt": {Data: []byte("c")},
+		"a/d.log":   {Data: []byte("d")},
+		"a/run.sh":  {Data: []byte("#!/bin/sh"), Mode: 0755},
+		"top":       {Data: []byte("t")},
+		"empty":     {Mode: fs.ModeDir},
+	}
+
+	var buf bytes.Buffer
+	if err := TarFS(fsys, ".", &buf, WithExclude("*.log")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := UnTarToMap(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"a/b/c.txt": []byte("c"), "a/run.sh": []byte("#!/bin/sh"), "top": []byte("t")}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("打包的文件是%q", files)
+	}
+
+	headers := tarHeaders(t, buf.Bytes())
+	for name, mode := range map[string]int64{"empty/": 0755, "top": 0644, "a/run.sh": 0755} {
+		if hdr, ok := headers[name]; !ok || hdr.Mode&0777 != mode {
+			t.Errorf("%s的权限不是%o：%v", name, mode, hdr)
+		}
+	}
+
+	//包内的名称相对于root
+	buf.Reset()
+	if err := TarFS(fsys, "a/b", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := UnTarToMap(buf.Bytes()); err != nil || len(files) != 1 || string(files["c.txt"]) != "c" {
+		t.Fatalf("以a/b为root打包的文件是%q：%v", files, err)
+	}
+	if err := TarFS(fsys, "../a", &buf); err == nil {
+		t.Fatal("不合法的root没有返回错误")
+	}
+}
@@ -0,0 +1,84 @@
+package targz
+
+import (
+	"context"
+	"path/filepath"
+)
+
+//TarGlob的模式没有匹配到任何文件或者目录
+type NoMatchError struct {
+	Pattern string
+}
+
+func (e *NoMatchError) Error() string {
+	return "没有匹配的文件或者目录：" + e.Pattern
+}
+
+//把filepath.Glob匹配到的所有文件和目录打包到dest，例如TarGlob("/var/log/*.log", "logs.tar.gz")
+//每个匹配项以自己的名称作为包内的顶层，目录会连同其下的内容一起打包，和TarAll相同；顶层名称重复时返回错误
+//模式的语法错误返回filepath.ErrBadPattern，没有匹配时返回*NoMatchError，这两种情况都不会创建dest
+//dest本身被匹配到时不会打包进去；dest和opts的处理同TarWithOptions
+func TarGlob(pattern string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if matches, err = withoutDest(matches, dest); err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return &NoMatchError{Pattern: pattern}
+	}
+	srcs, err := checkSrcs(matches)
+	if err != nil {
+		return err
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			d.abort()
+			panic(r)
+		}
+		err = d.finish(err)
+	}()
+
+	return tarToWriter(context.Background(), d.f, o, func(p *packer) error {
+		for _, src := range srcs {
+			if err := p.tarRooted(src); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//从匹配结果中去掉上次生成的dest，只匹配到dest时和没有匹配一样
+func withoutDest(matches []string, dest string) ([]string, error) {
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	kept := matches[:0]
+	for _, match := range matches {
+		absMatch, err := filepath.Abs(match)
+		if err != nil {
+			return nil, err
+		}
+		if absMatch != absDest {
+			kept = append(kept, match)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,31 @@
+package targz
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//dest本身能被模式匹配到时，重复打包也不会把上次生成的dest打包进去
+func TestTarGlobSkipsDest(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.log": "a", "b.txt": "b", "old.log/x": "x"})
+	dest := filepath.Join(dir, "logs.log")
+
+	for run := 0; run < 2; run++ {
+		if err := TarGlob(filepath.Join(dir, "*.log"), dest, WithCompression(Gzip), WithOverwrite()); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"a.log", "old.log/", "old.log/x"}
+		if got := archiveNames(t, dest, WithCompression(Gzip)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("第%d次打包：%v，应为%v", run+1, got, want)
+		}
+	}
+
+	//只匹配到dest时和没有匹配一样
+	var ne *NoMatchError
+	if err := TarGlob(dest, dest, WithCompression(Gzip), WithOverwrite()); !errors.As(err, &ne) {
+		t.Fatalf("只匹配到dest时返回了%v", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package targz
+
+import (
+	"os"
+)
+
+//这个平台只按名称判断隐藏文件
+func hiddenAttr(fi os.FileInfo) bool {
+	return false
+}
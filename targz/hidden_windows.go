@@ -0,0 +1,14 @@
+//go:build windows
+
+package targz
+
+import (
+	"os"
+	"syscall"
+)
+
+//Windows上隐藏文件不一定以`.`开头，而是带有FILE_ATTRIBUTE_HIDDEN属性
+func hiddenAttr(fi os.FileInfo) bool {
+	d, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	return ok && d.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
@@ -0,0 +1,55 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+//返回一个http.Handler，每个请求都把root打包后直接写入响应，适合让用户下载服务器上的目录
+//opts和Tar的选项相同，例如用WithExclude(".*")隐藏以`.`开头的文件；压缩格式默认为gzip，可以用WithCompression指定
+//选项在每个请求中重新应用，所以不要在opts中使用WithStats等会被多个请求同时写入的选项
+func TarHandler(root string, opts ...Option) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeTar(w, r, root, opts...)
+	})
+}
+
+//把dir打包后写入w，设置Content-Type和带有文件名的Content-Disposition
+//客户端断开连接时r.Context()被取消，打包随之停止；开始写入之后出错只能中断响应，无法再返回错误状态
+func ServeTar(w http.ResponseWriter, r *http.Request, dir string, opts ...Option) {
+	o, err := newOptions(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dir = filepath.Clean(dir)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ext, contentType := o.archiveType()
+	name := filepath.Base(dir)
+	if name == "." || name == string(os.PathSeparator) {
+		name = "archive"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ext}))
+
+	err = tarToWriter(r.Context(), w, o, func(p *packer) error {
+		return p.tarSrc(dir)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) && !isPartial(err) {
+		//响应头已经发出，只能中断连接，让客户端知道下载不完整
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,168 @@
+package targz
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//WithIgnoreFiles没有指定文件名时读取的忽略文件
+var defaultIgnoreFiles = []string{".gitignore", ".tarignore"}
+
+//打包时在每一层目录中查找忽略文件，按.gitignore的规则跳过其中列出的文件和目录，names默认为.gitignore和.tarignore
+//支持`#`注释、`!`取反、以`/`结尾只匹配目录、含有`/`的模式相对于忽略文件所在的目录、`**`匹配任意层级；
+//和git一样，下层目录的忽略文件优先于上层的，被忽略的目录不再遍历，其下的文件无法再用`!`重新包含
+//忽略文件本身会正常打包，跳过的项计入Stats.Skipped
+func WithIgnoreFiles(names ...string) Option {
+	return func(o *options) error {
+		if len(names) == 0 {
+			names = defaultIgnoreFiles
+		}
+		for _, name := range names {
+			if name == "" || strings.ContainsAny(name, `/\`) {
+				return errors.New("忽略文件的名称不能为空，也不能包含路径：" + name)
+			}
+		}
+		o.ignoreFiles = append(o.ignoreFiles, names...)
+		return nil
+	}
+}
+
+//一条忽略规则
+type ignoreRule struct {
+	segs    []string //以`/`分隔的各层模式，anchor为false时只有一层
+	negate  bool     //以`!`开头，重新包含匹配的项
+	dirOnly bool     //以`/`结尾，只匹配目录
+	anchor  bool     //含有`/`，相对于忽略文件所在的目录匹配
+}
+
+//一层目录中的忽略规则
+type ignoreRules struct {
+	dir   string //忽略文件所在目录在包内以`/`分隔的相对路径，源目录本身为""
+	rules []ignoreRule
+}
+
+//解析忽略文件的内容
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		//去掉没有转义的行尾空格
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		var r ignoreRule
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		r.anchor = strings.Contains(line, "/")
+		r.segs = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		//语法错误的规则和git一样忽略
+		if checkPattern(strings.Join(r.segs, "/")) != nil {
+			continue
+		}
+		if n := len(r.segs); r.anchor && r.segs[n-1] == "**" {
+			//`dir/**`只匹配dir下的内容，不匹配dir本身
+			r.segs = append(r.segs[:n-1], "*", "**")
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+//判断相对于忽略文件所在目录的路径name是否与规则匹配
+func (r *ignoreRule) match(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchor {
+		ok, _ := path.Match(r.segs[0], path.Base(name))
+		return ok
+	}
+	return matchSegments(r.segs, strings.Split(name, "/"))
+}
+
+//判断包内的相对路径是否被忽略文件排除，后面的规则和下层目录的规则优先
+func (p *packer) ignored(srcRelative string, fi os.FileInfo) bool {
+	if len(p.ignores) == 0 {
+		return false
+	}
+	name := strings.TrimSuffix(filepath.ToSlash(srcRelative), "/")
+
+	ignored := false
+	for i := range p.ignores {
+		set := &p.ignores[i]
+		rel := name
+		if set.dir != "" {
+			if !strings.HasPrefix(name, set.dir+"/") {
+				continue
+			}
+			rel = name[len(set.dir)+1:]
+		}
+		for j := range set.rules {
+			if set.rules[j].match(rel, fi.IsDir()) {
+				ignored = !set.rules[j].negate
+			}
+		}
+	}
+	return ignored
+}
+
+//读取目录中的忽略文件，加入到规则中，返回的函数用于在离开目录时移除
+//read按名称读取目录中的文件，文件不存在时不算错误，其他错误记录为警告
+func (p *packer) pushIgnores(dir string, read func(name string) ([]byte, error)) func() {
+	if len(p.opts.ignoreFiles) == 0 {
+		return func() {}
+	}
+	dir = strings.TrimSuffix(filepath.ToSlash(dir), "/")
+
+	set := ignoreRules{dir: dir}
+	for _, name := range p.opts.ignoreFiles {
+		data, err := read(name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				p.warn(path.Join(dir, name), WarnUnreadable, err)
+			}
+			continue
+		}
+		set.rules = append(set.rules, parseIgnore(data)...)
+	}
+	if len(set.rules) == 0 {
+		return func() {}
+	}
+
+	n := len(p.ignores)
+	p.ignores = append(p.ignores, set)
+	return func() { p.ignores = p.ignores[:n] }
+}
+
+//TarFS的遍历没有离开目录的回调，进入新的项时移除不是它上层目录的规则
+func (p *packer) trimIgnores(name string) {
+	for len(p.ignores) > 0 {
+		dir := p.ignores[len(p.ignores)-1].dir
+		if dir == "" || strings.HasPrefix(name, dir+"/") {
+			return
+		}
+		p.ignores = p.ignores[:len(p.ignores)-1]
+	}
+}
@@ -0,0 +1,222 @@
+package targz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//增量打包时记录被删除的项的文件，位于包的根目录，内容是包内名称的JSON数组
+//普通的解压会把它当作普通文件解压出来，UnTarChain读取它删除对应的文件
+const deletedListName = ".targz-deleted.json"
+
+//只打包修改时间晚于t的文件，目录总是会打包以保留目录结构；适合简单的增量备份
+func WithNewerThan(t time.Time) Option {
+	return func(o *options) error {
+		o.newerThan = t
+		return nil
+	}
+}
+
+//按快照文件增量打包，类似GNU tar的--listed-incremental
+//path不存在时打包全部内容；存在时只打包新增的和大小、修改时间有变化的文件，目录总是会打包，
+//上次打包之后被删除的项记录在包内的.targz-deleted.json中，按顺序用UnTarChain解压时会删除它们
+//打包完全成功之后才用这次的结果更新path，失败或者ContinueOnError时有项出错都不更新，下次仍然和上一个快照比较
+//快照中记录的是包内的名称，同一个快照应该始终用于同样的源和同样的WithStripPrefix、WithAddPrefix
+func WithSnapshot(path string) Option {
+	return func(o *options) error {
+		if path == "" {
+			return errors.New("快照文件的路径不能为空")
+		}
+		o.snapshot = path
+		return nil
+	}
+}
+
+//快照文件的内容
+type snapshotFile struct {
+	Version int                      `json:"version"`
+	Time    time.Time                `json:"time"` //打包开始的时间
+	Entries map[string]snapshotEntry `json:"entries"`
+}
+
+//快照中的一项，键为去掉了结尾`/`的包内名称
+type snapshotEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"` //修改时间，Unix纳秒
+	Dir     bool  `json:"dir,omitempty"`
+}
+
+//增量打包的状态
+type snapshot struct {
+	start time.Time
+	prev  map[string]snapshotEntry //上一次的快照，没有时为nil
+	cur   map[string]snapshotEntry //这一次遍历到的项
+}
+
+//WithSnapshot时读取上一次的快照，没有设置时返回nil
+func loadSnapshot(o *options) (*snapshot, error) {
+	if o.snapshot == "" {
+		return nil, nil
+	}
+	s := &snapshot{start: time.Now(), cur: make(map[string]snapshotEntry)}
+	data, err := ioutil.ReadFile(o.snapshot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取快照失败：%w", err)
+	}
+	if err == nil {
+		var f snapshotFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("快照%s的格式不正确：%w", o.snapshot, err)
+		}
+		if f.Version != 1 {
+			return nil, fmt.Errorf("不支持的快照版本：%d", f.Version)
+		}
+		s.prev = f.Entries
+		if s.prev == nil {
+			s.prev = make(map[string]snapshotEntry)
+		}
+	}
+	return s, nil
+}
+
+//判断文件是否和WithNewerThan的时间或者上一次的快照相比没有变化，同时在快照中记录这一项
+//目录总是返回false
+func (p *packer) unchanged(srcRelative string, fi os.FileInfo) bool {
+	if !fi.IsDir() && !p.opts.newerThan.IsZero() && !fi.ModTime().After(p.opts.newerThan) {
+		return true
+	}
+	if p.snap == nil {
+		return false
+	}
+
+	name, err := p.rename(filepath.ToSlash(srcRelative), fi.IsDir())
+	if err != nil {
+		//名称不合法的项由打包时报告错误
+		return false
+	}
+	key := strings.TrimSuffix(name, "/")
+	e := snapshotEntry{Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), Dir: fi.IsDir()}
+	if e.Dir {
+		e.Size = 0
+	}
+	p.snap.cur[key] = e
+	if e.Dir || p.snap.prev == nil {
+		return false
+	}
+	old, ok := p.snap.prev[key]
+	return ok && old == e
+}
+
+//上一次的快照中有、这一次没有遍历到的项，按名称排序
+func (s *snapshot) deleted() []string {
+	var names []string
+	for name := range s.prev {
+		if _, ok := s.cur[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//增量打包时在最后写入被删除的项的列表，没有被删除的项时不写入
+func (p *packer) tarDeleted() error {
+	if p.snap == nil {
+		return nil
+	}
+	deleted := p.snap.deleted()
+	if len(deleted) == 0 {
+		return nil
+	}
+	if p.names[deletedListName] {
+		return fmt.Errorf("包内已经有名为%s的文件，无法记录被删除的项", deletedListName)
+	}
+	data, err := json.Marshal(deleted)
+	if err != nil {
+		return err
+	}
+	e := &extraEntry{name: deletedListName, mode: 0644, modTime: p.snap.start, data: data, loaded: true}
+	return p.tarExtra(e)
+}
+
+//打包成功之后把这一次的结果写入快照文件，先写入临时文件再Rename，不会留下不完整的快照
+func (p *packer) saveSnapshot() error {
+	if p.snap == nil {
+		return nil
+	}
+	data, err := json.Marshal(snapshotFile{Version: 1, Time: p.snap.start, Entries: p.snap.cur})
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(p.opts.snapshot)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("写入快照失败：%w", err)
+	}
+	_, err = f.Write(data)
+	if p.opts.sync && err == nil {
+		err = f.Sync()
+	}
+	if er := f.Close(); er != nil && err == nil {
+		err = er
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p.opts.snapshot)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("写入快照失败：%w", err)
+	}
+	return nil
+}
+
+//按顺序解压一次完整打包和之后的各次增量打包，恢复到最后一次打包时的状态
+//每个增量包解压之后按其中的.targz-deleted.json删除上次之后被删除的文件和目录，这个文件本身不会解压出来
+//archives必须按打包的顺序排列，第一个通常是没有快照时打包的完整包
+func UnTarChain(archives []string, dstDir string, opts ...Option) error {
+	if len(archives) == 0 {
+		return errors.New("没有指定要解压的压缩包")
+	}
+	for _, archive := range archives {
+		//每个压缩包单独识别压缩格式
+		o, err := newOptions(opts)
+		if err != nil {
+			return err
+		}
+		o.applyDeleted = true
+		if err := unTarPath(context.Background(), archive, dstDir, o); err != nil {
+			return fmt.Errorf("解压%s失败：%w", archive, err)
+		}
+	}
+	return nil
+}
+
+//UnTarChain时删除.targz-deleted.json中列出的项
+func (u *unpacker) unTarDeleted(r io.Reader) error {
+	var names []string
+	if err := json.NewDecoder(r).Decode(&names); err != nil {
+		return fmt.Errorf("%s的格式不正确：%w", deletedListName, err)
+	}
+	for _, name := range names {
+		dst, err := u.safePath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+//解压出的数据超过这么多字节之后才检查WithMaxCompressionRatio，很小的压缩包压缩比很高是正常的
+const ratioCheckMin = 1 << 20
+
+//解压时限制解压出的所有文件的总字节数，防止很小的压缩包解压后占满磁盘；n小于等于0表示不限制
+//超过时立即停止解压并返回*ExtractLimitError，正在写入的文件会被删除，ContinueOnError时同样停止
+func WithMaxExtractSize(n int64) Option {
+	return func(o *options) error {
+		o.maxExtractSize = n
+		return nil
+	}
+}
+
+//解压时限制单个文件最多n字节，n小于等于0表示不限制；tar头中记录的大小超过时不会创建文件
+func WithMaxEntrySize(n int64) Option {
+	return func(o *options) error {
+		o.maxEntrySize = n
+		return nil
+	}
+}
+
+//解压时限制最多n项，目录、链接等所有类型的项都计入，n小于等于0表示不限制
+func WithMaxEntries(n int) Option {
+	return func(o *options) error {
+		o.maxEntries = n
+		return nil
+	}
+}
+
+//解压时限制解压出的字节数最多是读取的压缩数据的ratio倍，例如100表示100:1，ratio小于等于0表示不限制
+//解压出的数据超过1MB之后才开始检查；UnZip按各项记录的压缩后大小计算
+func WithMaxCompressionRatio(ratio int64) Option {
+	return func(o *options) error {
+		o.maxRatio = ratio
+		return nil
+	}
+}
+
+//解压时的各种限制
+type ExtractLimit int
+
+const (
+	LimitExtractSize      ExtractLimit = iota //WithMaxExtractSize
+	LimitEntrySize                            //WithMaxEntrySize
+	LimitEntries                              //WithMaxEntries
+	LimitCompressionRatio                     //WithMaxCompressionRatio
+)
+
+func (l ExtractLimit) String() string {
+	switch l {
+	case LimitExtractSize:
+		return "WithMaxExtractSize"
+	case LimitEntrySize:
+		return "WithMaxEntrySize"
+	case LimitEntries:
+		return "WithMaxEntries"
+	case LimitCompressionRatio:
+		return "WithMaxCompressionRatio"
+	}
+	return fmt.Sprintf("ExtractLimit(%d)", int(l))
+}
+
+//解压时超出了某一种限制，可能是恶意构造的压缩包
+type ExtractLimitError struct {
+	Limit ExtractLimit //超出的限制
+	Max   int64        //设置的值
+	Name  string       //超出限制时正在解压的项
+}
+
+func (e *ExtractLimitError) Error() string {
+	switch e.Limit {
+	case LimitExtractSize:
+		return fmt.Sprintf("解压%s时解压出的数据超过了%d字节", e.Name, e.Max)
+	case LimitEntrySize:
+		return fmt.Sprintf("%s超过了单个文件%d字节的限制", e.Name, e.Max)
+	case LimitEntries:
+		return fmt.Sprintf("解压到%s时超过了最多%d项的限制", e.Name, e.Max)
+	case LimitCompressionRatio:
+		return fmt.Sprintf("解压%s时压缩比超过了%d:1", e.Name, e.Max)
+	}
+	return fmt.Sprintf("解压%s时超出了%v的限制", e.Name, e.Limit)
+}
+
+//开始解压一项时检查项数和tar头中记录的大小
+func (u *unpacker) checkEntry(hdr *tar.Header) error {
+	o := u.opts
+	u.entries++
+	if o.maxEntries > 0 && u.entries > o.maxEntries {
+		return &ExtractLimitError{Limit: LimitEntries, Max: int64(o.maxEntries), Name: hdr.Name}
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	if o.maxEntrySize > 0 && hdr.Size > o.maxEntrySize {
+		return &ExtractLimitError{Limit: LimitEntrySize, Max: o.maxEntrySize, Name: hdr.Name}
+	}
+	if o.maxExtractSize > 0 && u.extracted+hdr.Size > o.maxExtractSize {
+		return &ExtractLimitError{Limit: LimitExtractSize, Max: o.maxExtractSize, Name: hdr.Name}
+	}
+	return nil
+}
+
+//统计从r中读出的数据，超过限制时返回*ExtractLimitError；tar头中的大小可能是伪造的，所以按实际读出的字节数计算
+func (u *unpacker) limitReader(name string, r io.Reader) io.Reader {
+	o := u.opts
+	if o.maxExtractSize <= 0 && o.maxEntrySize <= 0 && o.maxRatio <= 0 {
+		return r
+	}
+	return &limitedEntryReader{u: u, name: name, r: r}
+}
+
+//解压一项时读取内容的io.Reader
+type limitedEntryReader struct {
+	u    *unpacker
+	name string
+	r    io.Reader
+	n    int64 //这一项已经读出的字节数
+}
+
+func (r *limitedEntryReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.u.extracted += int64(n)
+
+	o := r.u.opts
+	switch {
+	case o.maxEntrySize > 0 && r.n > o.maxEntrySize:
+		return n, &ExtractLimitError{Limit: LimitEntrySize, Max: o.maxEntrySize, Name: r.name}
+	case o.maxExtractSize > 0 && r.u.extracted > o.maxExtractSize:
+		return n, &ExtractLimitError{Limit: LimitExtractSize, Max: o.maxExtractSize, Name: r.name}
+	case o.maxRatio > 0 && r.u.compressed != nil && r.u.extracted > ratioCheckMin &&
+		r.u.extracted/o.maxRatio > *r.u.compressed:
+		return n, &ExtractLimitError{Limit: LimitCompressionRatio, Max: o.maxRatio, Name: r.name}
+	}
+	return n, err
+}
+
+//统计读取的字节数，WithMaxCompressionRatio时用于统计读取的压缩数据
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+//超出解压的限制时删除写了一半的文件
+func removeOverLimit(dstFile string, err error) {
+	var le *ExtractLimitError
+	if errors.As(err, &le) {
+		os.Remove(dstFile)
+	}
+}
@@ -0,0 +1,69 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+)
+
+//生成内容全是0的.tar.gz，各项依次命名为a、b、c……，压缩比很高
+func zeroArchive(t *testing.T, sizes ...int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for i, size := range sizes {
+		hdr := &tar.Header{Name: string(rune('a' + i)), Size: size, Mode: 0644, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+//UnTarBytes和UnTarToMap超出各种限制时都返回*ExtractLimitError
+func TestExtractLimits(t *testing.T) {
+	data := zeroArchive(t, 1000, 50<<20, 10)
+	cases := []struct {
+		opt   Option
+		limit ExtractLimit
+		name  string
+	}{
+		{WithMaxExtractSize(10 << 20), LimitExtractSize, "b"},
+		{WithMaxEntrySize(1 << 20), LimitEntrySize, "b"},
+		{WithMaxEntries(2), LimitEntries, "c"},
+		{WithMaxCompressionRatio(100), LimitCompressionRatio, "b"},
+	}
+	extract := map[string]func(opts ...Option) error{
+		"UnTarBytes": func(opts ...Option) error {
+			return UnTarBytes(data, t.TempDir(), opts...)
+		},
+		"UnTarToMap": func(opts ...Option) error {
+			_, err := UnTarToMap(data, opts...)
+			return err
+		},
+	}
+	for fn, extract := range extract {
+		for _, c := range cases {
+			err := extract(c.opt)
+			var le *ExtractLimitError
+			if !errors.As(err, &le) || le.Limit != c.limit || le.Name != c.name {
+				t.Errorf("%s超出%v时返回了%v", fn, c.limit, err)
+			}
+		}
+		if err := extract(WithMaxExtractSize(60<<20), WithMaxEntries(3), WithMaxCompressionRatio(100000)); err != nil {
+			t.Errorf("%s没有超出限制时返回了%v", fn, err)
+		}
+	}
+}
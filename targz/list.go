@@ -0,0 +1,172 @@
+package targz
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//按列表打包baseDir下的文件，和tar -T一样，names是相对于baseDir的路径，包内的名称就是这些路径
+//按names的顺序写入，重复的路径只写入一次；所在的目录没有在列表中时自动写入目录项
+//列表中的目录只写入目录本身，不打包其下的内容；不存在的文件按WithErrorPolicy处理
+func TarFromList(baseDir string, names []string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+
+	baseDir = filepath.Clean(baseDir)
+	fi, err := os.Stat(baseDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.New("baseDir不是目录：" + baseDir)
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+
+	return tarToWriter(context.Background(), d.f, o, func(p *packer) error {
+		return p.tarList(baseDir, names)
+	})
+}
+
+//同TarFromList，从r中读取列表，每行一个路径，忽略空行和行尾的`\r`
+func TarFromListReader(baseDir string, r io.Reader, dest string, opts ...Option) error {
+	names, err := readList(r, '\n')
+	if err != nil {
+		return err
+	}
+	return TarFromList(baseDir, names, dest, opts...)
+}
+
+//同TarFromList，从r中读取以`\0`分隔的列表，例如find -print0的输出，路径中可以包含换行和空格
+//路径不做任何修剪，最后一个`\0`之后为空表示列表结束
+func TarFromNullList(baseDir string, r io.Reader, dest string, opts ...Option) error {
+	names, err := readList(r, 0)
+	if err != nil {
+		return err
+	}
+	return TarFromList(baseDir, names, dest, opts...)
+}
+
+//读取以delim分隔的列表，跳过空的项，只有以换行分隔时才去掉行尾的`\r`
+func readList(r io.Reader, delim byte) ([]string, error) {
+	var names []string
+	br := bufio.NewReader(r)
+	for {
+		name, err := br.ReadString(delim)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		name = strings.TrimSuffix(name, string(delim))
+		if delim == '\n' {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+		if err == io.EOF {
+			return names, nil
+		}
+	}
+}
+
+//把列表中的路径转换为baseDir下的相对路径，不允许超出baseDir
+func listName(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || clean == "." || filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(os.PathSeparator)) {
+		return "", errors.New("列表中的路径必须是baseDir下的相对路径：" + name)
+	}
+	return clean, nil
+}
+
+//按顺序打包列表中的每一项
+func (p *packer) tarList(baseDir string, names []string) error {
+	base := baseDir + string(os.PathSeparator)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		rel, err := listName(name)
+		if err == nil {
+			if seen[rel] {
+				continue
+			}
+			seen[rel] = true
+			err = p.tarListEntry(base, rel)
+		}
+		if err != nil {
+			if err := p.entryFailed(name, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//打包列表中的一项，先写入还没有写过的上层目录
+func (p *packer) tarListEntry(base string, rel string) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(base + rel)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(rel)
+	if dir != "." {
+		if err := p.tarListDirs(base, dir); err != nil {
+			return err
+		}
+	}
+
+	if !fi.IsDir() {
+		return p.tarEntry(base, rel, fi)
+	}
+	if p.skip(rel, fi) {
+		return nil
+	}
+	return p.tarListDir(base, rel, fi)
+}
+
+//依次写入dir和它的每一层上层目录，已经写入的目录会被writeHeader跳过
+func (p *packer) tarListDirs(base string, dir string) error {
+	var parts []string
+	for d := dir; d != "."; d = filepath.Dir(d) {
+		parts = append(parts, d)
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		fi, err := os.Stat(base + parts[i])
+		if err != nil {
+			return err
+		}
+		if err := p.tarListDir(base, parts[i], fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//只写入目录本身
+func (p *packer) tarListDir(base string, rel string, fi os.FileInfo) error {
+	hdr, err := p.header(fi, rel+string(os.PathSeparator), "")
+	if err != nil {
+		return err
+	}
+	p.addXattrs(hdr, base+rel)
+	return p.writeHeader(hdr)
+}
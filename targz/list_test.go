@@ -0,0 +1,53 @@
+//go:build unix
+
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//TarFromNullList读取find -print0格式的列表，文件名中的换行和首尾空格都原样保留
+func TestTarFromNullList(t *testing.T) {
+	files := map[string]string{
+		"line\nbreak.txt":  "newline",
+		"with space.txt":   "space",
+		" lead and trail ": "blank",
+		"dir/nested\n":     "nested",
+		"unlisted.txt":     "skip",
+	}
+	src := t.TempDir()
+	writeTree(t, src, files)
+
+	list := "line\nbreak.txt\x00with space.txt\x00 lead and trail \x00dir/nested\n\x00"
+	dest := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := TarFromNullList(src, strings.NewReader(list), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	if err := UnTar(dest, out); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if name == "unlisted.txt" {
+			if err == nil {
+				t.Fatal("打包了列表之外的文件")
+			}
+			continue
+		}
+		if err != nil || string(data) != content {
+			t.Fatalf("%q的内容是%q：%v", name, data, err)
+		}
+	}
+
+	//没有结尾的`\0`时最后一项同样有效，空的项被忽略
+	names, err := readList(strings.NewReader("a\x00\x00b\nc"), 0)
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b\nc"}) {
+		t.Fatalf("读取的列表是%q：%v", names, err)
+	}
+}
@@ -0,0 +1,49 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//列出压缩包中的所有项，不解压任何文件，压缩格式的识别和UnTar相同
+//WithMetadataOnly生成的目录包中，普通文件的Size是原来的大小，MetadataOnly为true
+func List(srcTar string, opts ...Option) ([]Entry, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	srcTar = filepath.FromSlash(srcTar)
+	o.decompressionFor(srcTar)
+	if !Exists(srcTar) {
+		return nil, errors.New("要列出的文件不存在：" + srcTar)
+	}
+
+	fr, err := os.Open(srcTar)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	gr, err := newDecompressReader(fr, o)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var entries []Entry
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, newEntry(hdr))
+	}
+}
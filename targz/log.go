@@ -0,0 +1,113 @@
+package targz
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+//日志的级别，数值和log/slog的级别相同，可以直接转换：slog.Level(level)
+type LogLevel int
+
+const (
+	LogDebug LogLevel = -4 //每一个跳过的项
+	LogInfo  LogLevel = 0  //开始和结束
+	LogWarn  LogLevel = 4  //不影响结果的问题，例如无法读取扩展属性
+	LogError LogLevel = 8  //出错的项和失败的操作
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return "LogLevel(" + strconv.Itoa(int(l)) + ")"
+}
+
+//通过fn输出打包和解压过程中的事件：开始和结束（附带统计信息）、跳过的项及原因、警告、出错的项
+//fields中的键都是小写英文，例如name、reason、error；slog的用户可以直接转换：
+//logger.Log(ctx, slog.Level(level), msg, "fields", fields)
+//fn在打包的goroutine中同步调用；不设置时没有任何额外开销
+func WithLogger(fn func(level LogLevel, msg string, fields map[string]any)) Option {
+	return func(o *options) error {
+		o.logger = fn
+		return nil
+	}
+}
+
+//以下函数在没有设置WithLogger时直接返回，不会创建fields
+
+func logStart(o *options, msg string) {
+	if o.logger == nil {
+		return
+	}
+	o.logger(LogInfo, msg, nil)
+}
+
+//跳过的项，reason是size、exclude、appledouble、hidden、ignore、unchanged、mount、depth之一
+func logSkip(o *options, name string, reason string) {
+	if o.logger == nil {
+		return
+	}
+	o.logger(LogDebug, "跳过", map[string]any{"name": filepath.ToSlash(name), "reason": reason})
+}
+
+func logWarning(o *options, name string, category WarningCategory, err error) {
+	if o.logger == nil {
+		return
+	}
+	o.logger(LogWarn, "警告", map[string]any{"name": name, "category": category.String(), "error": err})
+}
+
+func logEntryError(o *options, name string, err error) {
+	if o.logger == nil {
+		return
+	}
+	o.logger(LogError, "出错，已跳过", map[string]any{"name": name, "error": err})
+}
+
+//打包结束，成功时附带统计信息
+func (p *packer) logFinish(err error, compressed int64, elapsed time.Duration) {
+	if p.opts.logger == nil {
+		return
+	}
+	fields := map[string]any{
+		"files":           p.stats.Files,
+		"dirs":            p.stats.Dirs,
+		"bytes":           p.stats.Bytes,
+		"compressedBytes": compressed,
+		"skipped":         p.stats.Skipped + p.stats.SkippedBySize,
+		"errors":          p.stats.Errors,
+		"elapsed":         elapsed,
+	}
+	if err != nil {
+		fields["error"] = err
+		p.opts.logger(LogError, "打包失败", fields)
+		return
+	}
+	p.opts.logger(LogInfo, "打包完成", fields)
+}
+
+//解压结束
+func (u *unpacker) logFinish(err error, elapsed time.Duration) {
+	if u.opts.logger == nil {
+		return
+	}
+	fields := map[string]any{
+		"dir":     u.dstDir,
+		"errors":  len(u.errs),
+		"elapsed": elapsed,
+	}
+	if err != nil {
+		fields["error"] = err
+		u.opts.logger(LogError, "解压失败", fields)
+		return
+	}
+	u.opts.logger(LogInfo, "解压完成", fields)
+}
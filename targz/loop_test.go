@@ -0,0 +1,58 @@
+//go:build unix
+
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//WithDereference时指向上层目录的符号链接会造成循环，跳过并记录WarnLoop，打包很快完成
+func TestTarSymlinkLoop(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a/b/c.txt": "c"})
+	if err := os.Symlink("..", filepath.Join(src, "a", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(src, filepath.Join(src, "a", "b", "root")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("b", filepath.Join(src, "a", "same")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	var stats Stats
+	go func() {
+		_, err := TarBytes(src, WithDereference(), WithStats(&stats))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("打包没有结束，可能陷入了循环")
+	}
+
+	var loops []string
+	for _, w := range stats.Warnings {
+		if w.Category == WarnLoop {
+			loops = append(loops, w.Name)
+		}
+	}
+	if want := []string{"a/b/root", "a/same/root", "a/up"}; !reflect.DeepEqual(loops, want) {
+		t.Fatalf("WarnLoop是%v，应为%v", loops, want)
+	}
+
+	//指向同级目录的符号链接不是循环，按目录打包
+	got := planNames(t, src, WithDereference())
+	want := []string{"a/", "a/b/", "a/b/c.txt", "a/same/", "a/same/c.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("打包的项是%v，应为%v", got, want)
+	}
+}
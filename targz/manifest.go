@@ -0,0 +1,79 @@
+package targz
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+)
+
+//清单中的一项，对应包中的一个普通文件
+type ManifestEntry struct {
+	Name   string `json:"name"`   //包内的名称
+	Size   int64  `json:"size"`   //内容的字节数
+	SHA256 string `json:"sha256"` //内容的SHA-256，十六进制小写
+}
+
+//打包时计算每个普通文件的SHA-256，打包成功后向w写入清单，每行一个文件：`sha256  size  name`
+//摘要是对写入包中的字节计算的，和解压后的文件一致，可以直接用于审计
+//写入清单失败时整个打包返回错误；链接、目录等没有内容的项不在清单中
+func WithManifest(w io.Writer) Option {
+	return func(o *options) error {
+		o.manifest = w
+		o.manifestJSON = false
+		return nil
+	}
+}
+
+//同WithManifest，但以JSON数组的格式写入清单，数组的元素见ManifestEntry
+func WithManifestJSON(w io.Writer) Option {
+	return func(o *options) error {
+		o.manifest = w
+		o.manifestJSON = true
+		return nil
+	}
+}
+
+//复制文件内容时同时计算摘要
+type manifestHash struct {
+	hash.Hash
+	name string
+	size int64
+}
+
+func newManifestHash(name string, size int64) *manifestHash {
+	return &manifestHash{Hash: sha256.New(), name: name, size: size}
+}
+
+//内容复制成功后记下这个文件
+func (p *packer) addManifest(mh *manifestHash) {
+	p.manifest = append(p.manifest, ManifestEntry{
+		Name:   mh.name,
+		Size:   mh.size,
+		SHA256: hex.EncodeToString(mh.Sum(nil)),
+	})
+}
+
+//把清单写入WithManifest设置的io.Writer
+func (p *packer) writeManifest() error {
+	w := p.opts.manifest
+	if p.opts.manifestJSON {
+		entries := p.manifest
+		if entries == nil {
+			entries = []ManifestEntry{}
+		}
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			return fmt.Errorf("写入清单失败：%w", err)
+		}
+		return nil
+	}
+
+	for _, e := range p.manifest {
+		if _, err := fmt.Fprintf(w, "%s  %d  %s\n", e.SHA256, e.Size, e.Name); err != nil {
+			return fmt.Errorf("写入清单失败：%w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//按entries指定每一项在包内的名称打包到dest，键是以`/`分隔的包内名称，值是磁盘上的文件或者目录，
+//例如{"usr/local/bin/app": "build/app-linux-amd64", "etc/app/config.yml": "deploy/config.prod.yml"}
+//值是目录时连同其下的内容一起打包在键之下；键不能是绝对路径，也不能含有`..`，
+//展开之后有同名的项时返回错误（同名的目录除外），这些检查都在创建dest之前完成
+//按键的顺序打包；包内的名称不受WithStripPrefix、WithAddPrefix影响，dest和其他opts的处理同TarWithOptions
+func TarMap(entries map[string]string, dest string, opts ...Option) (err error) {
+	if len(entries) == 0 {
+		return errors.New("没有指定要打包的文件或者目录")
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	srcs := make(map[string]string, len(entries))
+	for name, src := range entries {
+		clean, err := mapEntryName(name)
+		if err != nil {
+			return err
+		}
+		if _, ok := srcs[clean]; ok {
+			return fmt.Errorf("包内的名称重复：%s", clean)
+		}
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return fmt.Errorf("%s对应的文件或者目录无法打包：%w", clean, err)
+		}
+		names = append(names, clean)
+		srcs[clean] = abs
+	}
+	sort.Strings(names)
+
+	//先展开一遍，只记录tar头，发现重名时不会创建dest
+	plan := newPacker(context.Background(), nil, o)
+	plan.dryRun, plan.unique = true, true
+	for _, name := range names {
+		if err := plan.tarAs(name, srcs[name]); err != nil {
+			return err
+		}
+	}
+	if err := multiError(plan.errs); err != nil {
+		return err
+	}
+	if err := plan.tarExtras(); err != nil {
+		return err
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			d.abort()
+			panic(r)
+		}
+		err = d.finish(err)
+	}()
+
+	return tarToWriter(context.Background(), d.f, o, func(p *packer) error {
+		p.unique = true
+		for _, name := range names {
+			if err := p.tarAs(name, srcs[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//检查TarMap的键，返回整理后的包内名称
+func mapEntryName(name string) (string, error) {
+	//`\`在Windows上解压时也是分隔符
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' })
+	for _, part := range parts {
+		if part == ".." {
+			return "", errors.New("包内的名称不能含有`..`：" + name)
+		}
+	}
+	clean, ok := cleanEntryName(name)
+	if !ok || filepath.IsAbs(name) {
+		return "", errors.New("包内的名称必须是相对路径：" + name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,27 @@
+package targz
+
+import (
+	"archive/tar"
+	"syscall"
+)
+
+//根据tar头创建字符设备、块设备或者命名管道
+func mknod(path string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	case tar.TypeFifo:
+		mode |= syscall.S_IFIFO
+	}
+	return syscall.Mknod(path, mode, int(mkdev(hdr.Devmajor, hdr.Devminor)))
+}
+
+//和glibc的makedev一致
+func mkdev(major, minor int64) uint64 {
+	ma, mi := uint64(major), uint64(minor)
+	return (ma&0xfffff000)<<32 | (ma&0x00000fff)<<8 |
+		(mi&0xffffff00)<<12 | (mi & 0x000000ff)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+)
+
+func mknod(path string, hdr *tar.Header) error {
+	return errors.New("这个平台不支持创建设备文件和命名管道")
+}
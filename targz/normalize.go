@@ -0,0 +1,61 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//打包时把包内的名称和符号链接的目标转换为form指定的Unicode规范化形式，只支持norm.NFC和norm.NFD
+//macOS上的文件名通常是NFD，在Linux上解压后和NFC的名称看起来一样但字节不同，这时可以使用norm.NFC
+//两个不同的文件规范化后同名时，后一个按WithErrorPolicy处理为错误，不会互相覆盖；依赖golang.org/x/text/unicode/norm
+func WithNormalizeNames(form norm.Form) Option {
+	return func(o *options) error {
+		if form != norm.NFC && form != norm.NFD {
+			return errors.New("WithNormalizeNames只支持norm.NFC和norm.NFD")
+		}
+		o.nameForm = &form
+		return nil
+	}
+}
+
+//解压时把包内的名称转换为form指定的Unicode规范化形式，只支持norm.NFC和norm.NFD
+//两项规范化后同名时，后一项按WithErrorPolicy处理为错误，不会覆盖前一项
+func WithNormalizeExtractedNames(form norm.Form) Option {
+	return func(o *options) error {
+		if form != norm.NFC && form != norm.NFD {
+			return errors.New("WithNormalizeExtractedNames只支持norm.NFC和norm.NFD")
+		}
+		o.extractForm = &form
+		return nil
+	}
+}
+
+//规范化后的名称和原来的名称的对应关系，用于发现规范化造成的重名
+type normalizer struct {
+	form  norm.Form
+	names map[string]string
+}
+
+func newNormalizer(form *norm.Form) *normalizer {
+	if form == nil {
+		return nil
+	}
+	return &normalizer{form: *form, names: make(map[string]string)}
+}
+
+//规范化hdr中的名称和链接目标，和之前另一个名称规范化后相同时返回错误
+func (n *normalizer) normalize(hdr *tar.Header) error {
+	name := n.form.String(hdr.Name)
+	if orig, ok := n.names[name]; ok && orig != hdr.Name {
+		return fmt.Errorf("%+q规范化后和%+q同名：%s", hdr.Name, orig, name)
+	}
+	n.names[name] = hdr.Name
+	hdr.Name = name
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = n.form.String(hdr.Linkname)
+	}
+	return nil
+}
@@ -0,0 +1,679 @@
+package targz
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/unicode/norm"
+)
+
+//Option用于调整打包和解压的行为，通过WithXxx系列函数创建
+//所有选项在调用开始时统一检查，不合法的取值或组合会在创建任何文件之前返回错误
+type Option func(o *options) error
+
+//打包和解压时用到的所有选项
+type options struct {
+	overwrite          OverwriteMode                                           //目标文件已存在时的处理方式
+	excludes           []string                                                //打包时要排除的模式
+	filter             func(relPath string, fi os.FileInfo) bool               //打包时的过滤函数
+	gzipLevel          int                                                     //gzip的压缩级别
+	gzipProcs          int                                                     //并行压缩的goroutine数，0表示不并行
+	rootEntry          bool                                                    //是否写入源目录本身
+	keepBaseDir        bool                                                    //是否以源目录的名称作为顶层目录
+	dereference        bool                                                    //是否打包符号链接指向的文件
+	owner              *owner                                                  //强制写入tar头的属主，nil表示使用文件本身的属主
+	deterministic      bool                                                    //是否生成可重现的压缩包
+	fixedTime          time.Time                                               //可重现模式下所有时间统一设置的值
+	format             tar.Format                                              //tar头的格式，FormatUnknown表示由archive/tar自动选择
+	sparse             bool                                                    //是否跳过读取稀疏文件中的空洞
+	xattrs             bool                                                    //是否打包和还原扩展属性
+	devices            bool                                                    //解压时是否创建设备文件
+	progress           func(ProgressInfo)                                      //打包进度的回调函数
+	stats              *Stats                                                  //打包完成后填写的统计信息
+	appendReplace      bool                                                    //追加时是否替换同名的项
+	memoryLimit        int64                                                   //TarBytes、UnTarToMap最多在内存中保存的字节数，小于等于0表示不限制
+	extras             []*extraEntry                                           //通过WithExtraEntry加入的文件，在遍历之后写入
+	directWrite        bool                                                    //是否直接写入目标文件，而不是先写入临时文件再Rename
+	maxArchiveSize     int64                                                   //压缩后的数据最多的字节数，小于等于0表示不限制
+	manifest           io.Writer                                               //打包成功后写入清单的位置，nil表示不生成清单
+	manifestJSON       bool                                                    //是否以JSON格式写入清单
+	gzipHeader         gzip.Header                                             //gzip头中的原始文件名、注释和修改时间
+	compression        Compression                                             //打包时使用的压缩格式
+	xzPreset           int                                                     //xz的预设级别
+	zstdLevel          int                                                     //zstd的压缩级别
+	zstdProcs          int                                                     //zstd压缩使用的goroutine数，0表示使用默认值
+	lz4Level           int                                                     //lz4的压缩级别
+	lz4BlockSize       int                                                     //lz4帧的块大小，0表示使用默认值
+	brotliQuality      int                                                     //brotli的压缩质量
+	compressionSet     bool                                                    //是否用WithCompression明确指定了压缩格式
+	noHardLinks        bool                                                    //把硬链接都打包为普通文件，zip无法表示硬链接
+	stripPrefix        string                                                  //打包时从包内名称中去掉的前缀
+	addPrefix          string                                                  //打包时加在包内名称前面的前缀
+	noExtraTimes       bool                                                    //是否清除访问时间和状态改变时间
+	modeOverride       *modeOverride                                           //强制设置的权限，nil表示使用文件本身的权限
+	modeMask           os.FileMode                                             //从权限中去掉的位
+	minSize            int64                                                   //打包的普通文件的最小字节数
+	maxSize            int64                                                   //打包的普通文件的最大字节数，小于0表示不限制
+	skipHidden         bool                                                    //跳过隐藏的文件和目录
+	ignoreFiles        []string                                                //在每一层目录中读取的忽略文件名称
+	oneFileSystem      bool                                                    //不跨越文件系统
+	rateLimit          int64                                                   //读写文件内容的速度限制，字节每秒
+	checksums          bool                                                    //在PAX记录中保存每个文件的SHA-256
+	verifyChecksums    VerifyMode                                              //解压时校验SHA-256的方式
+	errorPolicy        ErrorPolicy                                             //某一项出错时的处理方式
+	entryCallback      func(name string, hdr *tar.Header)                      //每写入一项后调用
+	logger             func(level LogLevel, msg string, fields map[string]any) //输出事件
+	maxDepth           int                                                     //最多遍历的层数，小于0表示不限制
+	selfFiles          []os.FileInfo                                           //正在写入的压缩包和临时文件，打包时跳过
+	rsyncable          bool                                                    //生成对rsync友好的gzip数据
+	compressor         Compressor                                              //用WithCompressor指定或者按扩展名找到的自定义压缩格式，优先于compression
+	tees               []io.Writer                                             //同时写入压缩包的其他目标
+	verify             bool                                                    //生成压缩包后重新读取校验
+	sync               bool                                                    //关闭前把生成的文件同步到磁盘
+	sanitize           *modeOverride                                           //WithSanitizePermissions时文件和目录权限的上限，dir同时用于有执行位的文件
+	extendedTimes      bool                                                    //打包时保存访问时间、状态改变时间和创建时间
+	restoreTimes       bool                                                    //解压时恢复修改时间和访问时间
+	skipAppleDouble    bool                                                    //打包时跳过macOS的元数据文件
+	nameForm           *norm.Form                                              //打包时包内名称的Unicode规范化形式
+	extractForm        *norm.Form                                              //解压时包内名称的Unicode规范化形式
+	sourceEncoding     encoding.Encoding                                       //打包时文件名的原始编码
+	rawNames           bool                                                    //解压时使用GOUTILS.rawname记录的原始文件名
+	winAttrs           bool                                                    //保存和还原Windows文件属性
+	stripSpecialBits   bool                                                    //打包时清除setuid、setgid和sticky位
+	bufferSize         int                                                     //复制文件内容的缓冲区大小
+	gzipPools          *gzipPools                                              //Archiver复用的gzip.Writer
+	prescan            bool                                                    //打包之前先统计总字节数和总项数
+	entryRatio         func(EntryRatio)                                        //每写完一项报告压缩前后的大小
+	dedupe             bool                                                    //内容相同的文件打包为硬链接
+	linksAsCopies      bool                                                    //解压时把硬链接复制为独立的文件
+	newerThan          time.Time                                               //只打包修改时间晚于它的文件
+	snapshot           string                                                  //增量打包的快照文件
+	applyDeleted       bool                                                    //UnTarChain时按增量包中的列表删除文件
+	trailingSlash      bool                                                    //按src是否以分隔符结尾决定是否保留顶层目录
+	shardStats         *[]Stats                                                //TarSharded时每个压缩包的统计信息
+	relativeLinks      bool                                                    //把指向打包的目录之内的绝对路径符号链接改写为相对路径
+	warnExternalLinks  bool                                                    //WithRelativeSymlinks时为指向目录之外的绝对路径链接记录警告
+	metadataOnly       bool                                                    //只打包元数据，不写入文件内容
+	walkConcurrency    int                                                     //预读子目录的goroutine数
+	checkpoint         string                                                  //WithCheckpoint时保存断点的文件
+	checkpointInterval time.Duration                                           //保存断点的间隔
+	checkpointer       *checkpointer                                           //TarContext和ResumeTar创建的断点状态
+	digest             hash.Hash                                               //WithStats时计算未压缩的tar流的摘要，每次打包时创建
+	maxExtractSize     int64                                                   //解压出的所有文件最多的字节数，小于等于0表示不限制
+	maxEntrySize       int64                                                   //解压时单个文件最多的字节数，小于等于0表示不限制
+	maxEntries         int                                                     //解压时最多的项数，小于等于0表示不限制
+	maxRatio           int64                                                   //解压时最大的压缩比，小于等于0表示不限制
+	extractOverwrite   OverwriteMode                                           //解压时目标位置已经有文件的处理方式
+}
+
+//在默认选项上依次应用opts，并检查最终的组合是否合法
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		gzipLevel:     gzip.DefaultCompression,
+		memoryLimit:   defaultMemoryLimit,
+		xzPreset:      defaultXzPreset,
+		zstdLevel:     defaultZstdLevel,
+		brotliQuality: defaultBrotliQuality,
+		maxSize:       -1,
+		maxDepth:      -1,
+		bufferSize:    defaultBufferSize,
+
+		extractOverwrite: OverwriteReplace,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+//检查选项之间的组合是否合法，互相冲突的选项在这里返回错误
+func (o *options) validate() error {
+	if o.maxSize >= 0 && o.minSize > o.maxSize {
+		return fmt.Errorf("WithMinSize(%d)大于WithMaxSize(%d)，不会打包任何文件", o.minSize, o.maxSize)
+	}
+	if o.xattrs && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("扩展属性只能保存在PAX格式中，不能和%v格式同时使用", o.format)
+	}
+	if o.rsyncable && o.gzipProcs > 0 {
+		return errors.New("WithRsyncable不能和WithParallelGzip同时使用")
+	}
+	if o.entryRatio != nil && o.gzipProcs > 0 {
+		return errors.New("WithEntryRatio不能和WithParallelGzip同时使用")
+	}
+	if o.winAttrs && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("Windows文件属性只能保存在PAX格式中，WithWindowsAttributes不能和%v格式同时使用", o.format)
+	}
+	if o.sourceEncoding != nil && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("原始文件名只能保存在PAX格式中，WithSourceEncoding不能和%v格式同时使用", o.format)
+	}
+	if o.extendedTimes && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("创建时间只能保存在PAX格式中，WithExtendedTimes不能和%v格式同时使用", o.format)
+	}
+	if o.extendedTimes && o.noExtraTimes {
+		return errors.New("WithExtendedTimes不能和WithoutExtraTimes同时使用")
+	}
+	if o.metadataOnly && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("原来的大小只能保存在PAX格式中，WithMetadataOnly不能和%v格式同时使用", o.format)
+	}
+	if o.metadataOnly && (o.checksums || o.dedupe || o.manifest != nil) {
+		return errors.New("WithMetadataOnly不读取文件内容，不能和WithChecksums、WithDedupe、WithManifest同时使用")
+	}
+	if o.checksums && (o.format == tar.FormatUSTAR || o.format == tar.FormatGNU) {
+		return fmt.Errorf("WithChecksums只能用于PAX格式，不能和%v格式同时使用", o.format)
+	}
+	if o.checkpoint != "" && (o.gzipProcs > 0 || o.rsyncable || o.entryRatio != nil || len(o.tees) > 0 ||
+		o.verify || o.manifest != nil || o.snapshot != "") {
+		return errors.New("WithCheckpoint不能和WithParallelGzip、WithRsyncable、WithEntryRatio、WithTee、WithVerify、WithManifest、WithSnapshot同时使用")
+	}
+	return nil
+}
+
+//目标文件已存在时覆盖它，默认会放弃打包并返回错误，同WithOverwriteMode(OverwriteReplace)
+func WithOverwrite() Option {
+	return WithOverwriteMode(OverwriteReplace)
+}
+
+//设置目标文件已存在时的处理方式，见OverwriteMode
+func WithOverwriteMode(mode OverwriteMode) Option {
+	return func(o *options) error {
+		switch mode {
+		case OverwriteFail, OverwriteReplace, OverwriteSkip:
+		default:
+			return fmt.Errorf("不支持的覆盖方式：%v", mode)
+		}
+		o.overwrite = mode
+		return nil
+	}
+}
+
+//直接写入目标文件，而不是先写入同一目录下的临时文件再Rename
+//适合不支持Rename或者Rename代价很高的文件系统（例如某些网络文件系统），
+//打包失败时仍然会删除写了一半的目标文件；覆盖已存在的文件时，原文件先改名为dest.bak-<随机数>，
+//打包成功后删除，失败时改回原来的名称
+func WithDirectWrite() Option {
+	return func(o *options) error {
+		o.directWrite = true
+		return nil
+	}
+}
+
+//生成的文件关闭前调用Sync写入磁盘，Rename之后再同步所在的目录，保证返回nil之后断电也不会丢失压缩包
+//默认不同步，速度更快；对TarSplit的每个分卷和Append同样有效
+func WithSync() Option {
+	return func(o *options) error {
+		o.sync = true
+		return nil
+	}
+}
+
+//打包时对每一个文件和目录调用filter，返回false时跳过该项，目录会连同其下的内容一起跳过
+//relPath是将要写入hdr.Name的相对路径，以`/`分隔，目录以`/`结尾
+//filter在排除模式之后调用，被WithExclude排除的项不会再传给filter
+func WithFilter(filter func(relPath string, fi os.FileInfo) bool) Option {
+	return func(o *options) error {
+		o.filter = filter
+		return nil
+	}
+}
+
+//设置gzip的压缩级别，取值同compress/gzip，例如gzip.BestSpeed、gzip.BestCompression
+//超出范围的级别会在创建任何文件之前返回compress/gzip的错误
+func WithGzipLevel(level int) Option {
+	return func(o *options) error {
+		if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+			return err
+		}
+		o.gzipLevel = level
+		return nil
+	}
+}
+
+//设置gzip头中的原始文件名、注释和修改时间，gzip -l等工具会显示这些信息
+//modTime为零值时不写入时间；设置了WithDeterministic时时间总是不写入，保证结果可重现
+//name和comment只能包含Latin-1字符，否则打包时返回compress/gzip的错误
+func WithGzipHeader(name string, comment string, modTime time.Time) Option {
+	return func(o *options) error {
+		o.gzipHeader = gzip.Header{Name: name, Comment: comment, ModTime: modTime}
+		return nil
+	}
+}
+
+//使用workers个goroutine并行压缩，适合打包很大的目录
+//数据会被切成1MB的块分别压缩，结果是多个gzip成员首尾相接，标准的gzip、tar -xzf都可以解压，
+//但压缩率会略低于单线程压缩，内存占用约为workers×1MB
+//workers小于等于0时使用runtime.GOMAXPROCS(0)
+func WithParallelGzip(workers int) Option {
+	return func(o *options) error {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		o.gzipProcs = workers
+		return nil
+	}
+}
+
+//打包目录时，在遍历之前先写入源目录本身，包内名称为`./`
+//这样解压时可以还原源目录的权限和时间，空目录打包后也不再是空的压缩包
+func WithRootEntry() Option {
+	return func(o *options) error {
+		o.rootEntry = true
+		return nil
+	}
+}
+
+//打包目录时，以源目录的名称作为包内的顶层目录，和GNU tar的行为一致
+//例如打包/data/myapp时，包内的名称为myapp/conf/app.yml，并包含myapp/目录本身，
+//解压时会在目标文件夹下重建一次myapp目录，不会把文件散落在目标文件夹中
+//因为顶层目录本身已经写入，同时设置WithRootEntry时不会再写入`./`
+func WithKeepBaseDir() Option {
+	return func(o *options) error {
+		o.keepBaseDir = true
+		return nil
+	}
+}
+
+//和rsync一样由src结尾的分隔符决定是否保留顶层目录，优先于WithKeepBaseDir：
+//"/data/app"打包为app/...，等同于WithKeepBaseDir；"/data/app/"和"/data/app/."只打包目录下的内容
+//"."、"/"等无法确定顶层名称的src不受影响，按是否设置了WithKeepBaseDir处理；src是文件时没有区别
+//只打包目录下的内容时WithRootEntry仍然有效；WithStripPrefix、WithAddPrefix作用于这里确定的名称
+func WithTrailingSlash() Option {
+	return func(o *options) error {
+		o.trailingSlash = true
+		return nil
+	}
+}
+
+//WithTrailingSlash时按src的写法设置是否保留顶层目录，必须在filepath.Clean(src)之前调用
+func (o *options) srcForm(src string) {
+	if !o.trailingSlash || src == "" {
+		return
+	}
+	base := filepath.Base(src)
+	if base == "." || base == ".." || base == string(filepath.Separator) {
+		//"dir/."只打包内容，单独的"."、".."、"/"保持原来的行为
+		if base != "." || len(src) < 2 || !os.IsPathSeparator(src[len(src)-2]) {
+			return
+		}
+		o.keepBaseDir = false
+		return
+	}
+	o.keepBaseDir = !os.IsPathSeparator(src[len(src)-1])
+}
+
+//和tar -h一样，打包符号链接指向的内容，而不是链接本身
+//指向文件的链接打包为普通文件，指向目录的链接会进入目录继续遍历，
+//指向正在遍历的上层目录（例如a -> ..）的链接会被跳过并记录警告，避免无限循环
+//默认会把符号链接打包为TypeSymlink，只记录链接的目标；这个模式下链接失效时会返回错误
+func WithDereference() Option {
+	return func(o *options) error {
+		o.dereference = true
+		return nil
+	}
+}
+
+//强制写入tar头的属主
+type owner struct {
+	uid, gid     int
+	setIDs       bool
+	uname, gname string
+	setNames     bool
+}
+
+//把所有文件和目录的属主id强制设置为uid和gid，而不是打包者的id
+//除非同时设置了WithOwnerNames，否则会清空用户名和组名，解压时只按id还原属主
+func WithOwner(uid, gid int) Option {
+	return func(o *options) error {
+		if uid < 0 || gid < 0 {
+			return errors.New("属主id不能为负数")
+		}
+		if o.owner == nil {
+			o.owner = &owner{}
+		}
+		o.owner.uid, o.owner.gid, o.owner.setIDs = uid, gid, true
+		return nil
+	}
+}
+
+//把所有文件和目录的用户名和组名强制设置为uname和gname
+//GNU tar等工具解压时优先按名称还原属主，例如WithOwnerNames("root", "root")
+func WithOwnerNames(uname, gname string) Option {
+	return func(o *options) error {
+		if o.owner == nil {
+			o.owner = &owner{}
+		}
+		o.owner.uname, o.owner.gname, o.owner.setNames = uname, gname, true
+		return nil
+	}
+}
+
+//WithModeOverride设置的权限
+type modeOverride struct {
+	file, dir os.FileMode
+}
+
+//把包中所有文件的权限设置为fileMode，目录的权限设置为dirMode，例如WithModeOverride(0644, 0755)
+//只改变tar头中的权限位，不会改动磁盘上的文件；符号链接的权限没有意义，保持不变
+func WithModeOverride(fileMode, dirMode os.FileMode) Option {
+	return func(o *options) error {
+		if fileMode&^os.ModePerm != 0 || dirMode&^os.ModePerm != 0 {
+			return errors.New("WithModeOverride只能设置权限位")
+		}
+		o.modeOverride = &modeOverride{file: fileMode, dir: dirMode}
+		return nil
+	}
+}
+
+//限制包中所有项的权限，去掉组和其他用户的写权限：目录和有执行位的文件最多为0755，其他文件最多为0644
+//例如0777的文件打包为0755，0666的文件打包为0644；只改变tar头中的权限位，不会改动磁盘上的文件
+//在WithModeOverride、WithModeMask之后生效，需要其他的上限时使用WithSanitizeModes
+func WithSanitizePermissions() Option {
+	return WithSanitizeModes(0644, 0755)
+}
+
+//同WithSanitizePermissions，普通文件的权限最多为fileMode，目录和有执行位的文件最多为execMode
+func WithSanitizeModes(fileMode, execMode os.FileMode) Option {
+	return func(o *options) error {
+		if fileMode&^os.ModePerm != 0 || execMode&^os.ModePerm != 0 {
+			return errors.New("WithSanitizeModes只能设置权限位")
+		}
+		o.sanitize = &modeOverride{file: fileMode, dir: execMode}
+		return nil
+	}
+}
+
+//打包时清除所有项的setuid、setgid和sticky位，适合对外发布的压缩包
+//默认这些位和权限一起保存在tar头中，例如打包/usr/bin时ping的setuid位；只改变tar头，不会改动磁盘上的文件
+func WithStripSpecialBits() Option {
+	return func(o *options) error {
+		o.stripSpecialBits = true
+		return nil
+	}
+}
+
+//和umask一样，从包中所有项的权限中去掉mask中的位，例如WithModeMask(0022)去掉组和其他用户的写权限，保留执行权限
+//同时设置WithModeOverride时，先设置权限再去掉mask中的位
+func WithModeMask(mask os.FileMode) Option {
+	return func(o *options) error {
+		if mask&^os.ModePerm != 0 {
+			return errors.New("WithModeMask只能设置权限位")
+		}
+		o.modeMask = mask
+		return nil
+	}
+}
+
+//隐藏打包者的身份：所有项（包括目录、符号链接和硬链接）的属主id设置为0，用户名和组名清空
+//同WithOwner(0, 0)加上WithOwnerNames("", "")，适合对外发布的压缩包
+func WithAnonymizeOwners() Option {
+	return func(o *options) error {
+		o.owner = &owner{setIDs: true, setNames: true}
+		return nil
+	}
+}
+
+//不在PAX记录中保存访问时间和状态改变时间，只保留修改时间，和WithAnonymizeOwners一起使用可以避免泄露访问记录
+func WithoutExtraTimes() Option {
+	return func(o *options) error {
+		o.noExtraTimes = true
+		return nil
+	}
+}
+
+//生成可重现的压缩包：同样的目录树每次打包得到的字节完全相同，可以直接比较摘要
+//目录下的文件按名称排序，所有时间统一为Unix纪元，属主id、用户名和组名清零，gzip头中的时间为0
+//同时设置的WithOwner、WithOwnerNames仍然生效，它们同样不会影响可重现性
+func WithDeterministic() Option {
+	return WithDeterministicTime(time.Unix(0, 0))
+}
+
+//同WithDeterministic，但所有时间统一设置为t，例如最后一次提交的时间
+func WithDeterministicTime(t time.Time) Option {
+	return func(o *options) error {
+		o.deterministic = true
+		o.fixedTime = t
+		return nil
+	}
+}
+
+//指定所有tar头使用的格式：tar.FormatUSTAR、tar.FormatPAX或者tar.FormatGNU
+//默认由archive/tar为每一项选择能表示它的最简单的格式
+//某一项无法用指定的格式表示时（例如USTAR下名称过长），会在写入这一项之前返回说明原因的错误
+func WithFormat(format tar.Format) Option {
+	return func(o *options) error {
+		switch format {
+		case tar.FormatUSTAR, tar.FormatPAX, tar.FormatGNU:
+		default:
+			return fmt.Errorf("不支持的tar格式：%v", format)
+		}
+		o.format = format
+		return nil
+	}
+}
+
+//打包稀疏文件（例如虚拟机磁盘镜像）时，只读取其中的数据区，空洞直接写入0
+//包中仍然是完整的内容，任何解压工具都能正确还原，只是省去了读取和校验大量0的开销
+//目前只在linux上生效，其他平台或者不支持查找空洞的文件系统按普通文件打包
+func WithSparse() Option {
+	return func(o *options) error {
+		o.sparse = true
+		return nil
+	}
+}
+
+//打包时读取文件和目录的扩展属性（例如user.*、security.capability），
+//按GNU tar和bsdtar的约定保存在PAX记录SCHILY.xattr.<名称>中；解压时还原这些扩展属性
+//目前只在linux上支持，读取或者还原失败（例如文件系统不支持）只记录警告，不会中断打包或者解压
+//扩展属性只能保存在PAX格式中，所以不能和WithFormat(tar.FormatUSTAR)等同时使用
+func WithXattrs() Option {
+	return func(o *options) error {
+		o.xattrs = true
+		return nil
+	}
+}
+
+//解压时用mknod创建包中的字符设备和块设备，通常需要root权限
+//默认跳过设备文件并记录警告；权限不足或者平台不支持（目前只支持linux）时同样跳过并记录警告
+func WithDevices() Option {
+	return func(o *options) error {
+		o.devices = true
+		return nil
+	}
+}
+
+//打包时通过fn报告进度：每完成一项报告一次，复制大文件时每写入1MB再报告一次
+//fn在打包的goroutine中同步调用，耗时的操作会拖慢打包，但不会影响包的内容
+//不设置时没有任何额外开销
+func WithProgress(fn func(ProgressInfo)) Option {
+	return func(o *options) error {
+		o.progress = fn
+		return nil
+	}
+}
+
+//打包完成后把统计信息填写到stats中，Tar、TarToWriter等所有打包函数都支持
+//压缩后的字节数在gzip之后统计，所以写入任意io.Writer时同样准确
+//用于UnTar、UnZip等解压函数时在解压结束后填写，其中的Warnings列出了跳过的设备文件、无法还原的扩展属性等问题
+func WithStats(stats *Stats) Option {
+	return func(o *options) error {
+		o.stats = stats
+		return nil
+	}
+}
+
+//向压缩包追加时，用新的项替换原有的同名项，默认遇到同名的项会返回错误
+func WithAppendReplace() Option {
+	return func(o *options) error {
+		o.appendReplace = true
+		return nil
+	}
+}
+
+//设置TarBytes、UnTarToMap等在内存中处理数据的函数最多保存多少字节，默认256MB
+//n小于等于0表示不限制
+func WithMemoryLimit(n int64) Option {
+	return func(o *options) error {
+		o.memoryLimit = n
+		return nil
+	}
+}
+
+//限制压缩后的数据最多n字节，超过时立即停止打包并返回*ArchiveSizeError，其中记录了正在写入的项
+//写入文件时会删除写了一半的文件；TarToWriter等写入io.Writer的函数同样会停止，但已写出的数据无法收回
+//n小于等于0表示不限制
+func WithMaxArchiveSize(n int64) Option {
+	return func(o *options) error {
+		o.maxArchiveSize = n
+		return nil
+	}
+}
+
+//打包时去掉包内名称开头的前缀p，例如从build/stage/bin/app得到bin/app，不以p开头的名称保持不变
+//p按路径逐级匹配，不能是绝对路径，也不能包含`..`；文件去掉前缀后名称为空时打包会返回错误
+//WithExclude、WithFilter仍然按改写之前的名称匹配
+func WithStripPrefix(p string) Option {
+	return func(o *options) error {
+		clean, err := cleanPrefix(p)
+		if err != nil {
+			return err
+		}
+		o.stripPrefix = clean
+		return nil
+	}
+}
+
+//打包时在所有包内名称的前面加上前缀p，例如opt/myapp，和WithStripPrefix同时使用时先去掉再加上
+//根目录（WithRootEntry写入的`./`）会成为p本身；WithExtraEntry加入的项使用明确指定的名称，不加前缀
+func WithAddPrefix(p string) Option {
+	return func(o *options) error {
+		clean, err := cleanPrefix(p)
+		if err != nil {
+			return err
+		}
+		o.addPrefix = clean
+		return nil
+	}
+}
+
+//清理并检查前缀，返回以`/`分隔、不以`/`结尾的前缀
+func cleanPrefix(p string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(p))
+	if p == "" || clean == "." || !validPrefix(clean) {
+		return "", errors.New("前缀不合法：" + p)
+	}
+	return clean, nil
+}
+
+//名称不是绝对路径，也不包含`..`
+func validPrefix(name string) bool {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+//打包时跳过小于n字节的普通文件，例如WithMinSize(1)跳过空文件；目录仍然会继续遍历
+//跳过的文件数和字节数记录在Stats.SkippedBySize和Stats.SkippedBySizeBytes中
+func WithMinSize(n int64) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("文件大小的下限不能为负数：%d", n)
+		}
+		o.minSize = n
+		return nil
+	}
+}
+
+//打包时跳过大于n字节的普通文件，例如WithMaxSize(1<<30)跳过超过1GB的文件；目录仍然会继续遍历
+//跳过的文件数和字节数记录在Stats.SkippedBySize和Stats.SkippedBySizeBytes中
+func WithMaxSize(n int64) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("文件大小的上限不能为负数：%d", n)
+		}
+		o.maxSize = n
+		return nil
+	}
+}
+
+//文件大小是否在WithMinSize、WithMaxSize的范围内
+func (o *options) sizeAllowed(size int64) bool {
+	return size >= o.minSize && (o.maxSize < 0 || size <= o.maxSize)
+}
+
+//打包时跳过名称以`.`开头的隐藏文件和目录，隐藏的目录不再遍历；Windows上还会跳过带有隐藏属性的项
+//要打包的源本身即使是隐藏的也会打包，跳过的项计入Stats.Skipped
+func WithSkipHidden() Option {
+	return func(o *options) error {
+		o.skipHidden = true
+		return nil
+	}
+}
+
+//打包时跳过macOS生成的元数据：.DS_Store、.AppleDouble目录和以`._`开头的AppleDouble资源分支文件
+//这些项都以`.`开头，WithSkipHidden同样会跳过；单独设置这个选项时只跳过这些项，其他隐藏文件照常打包
+//跳过的项计入Stats.Skipped和Stats.SkippedAppleDouble，WithLogger的reason为appledouble
+func WithSkipAppleDouble() Option {
+	return func(o *options) error {
+		o.skipAppleDouble = true
+		return nil
+	}
+}
+
+//打包时不跨越文件系统，跳过和源不在同一个设备上的目录（即挂载点，例如/proc、网络文件系统），并为每个跳过的挂载点记录警告
+//只在可以取得设备号的平台（Unix）上支持，其他平台返回错误
+func WithOneFileSystem() Option {
+	return func(o *options) error {
+		if !deviceIDSupported {
+			return errors.New("这个平台不支持WithOneFileSystem")
+		}
+		o.oneFileSystem = true
+		return nil
+	}
+}
+
+//每写入一项（文件、目录、链接等）后调用fn，name是写入包中的最终名称，和解压时看到的一致，hdr不能修改
+//调用的顺序就是包中的顺序；Append时原有的项也会报告，Plan不会调用fn
+func WithEntryCallback(fn func(name string, hdr *tar.Header)) Option {
+	return func(o *options) error {
+		o.entryCallback = fn
+		return nil
+	}
+}
+
+//打包时最多遍历到第n层，源的直接子项是第0层，例如WithMaxDepth(0)只打包源目录下的文件和目录本身
+//第n层的目录仍然会写入，只是不再打包其下的内容，这样的目录数记录在Stats.DepthPruned中
+func WithMaxDepth(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("遍历的深度不能为负数：%d", n)
+		}
+		o.maxDepth = n
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+//目标已存在时的处理方式
+type OverwriteMode int
+
+const (
+	OverwriteFail    OverwriteMode = iota //放弃并返回包装了ErrExist的错误，默认的方式
+	OverwriteReplace                      //覆盖已存在的目标
+	OverwriteSkip                         //什么都不做，返回ErrSkipped
+	OverwriteNewer                        //只用于WithExtractOverwrite：已存在的文件比包内的新或者一样新时保留它
+)
+
+//OverwriteFail时，目标已存在返回的错误包装了ErrExist，可以用errors.Is判断
+var ErrExist = errors.New("目标文件已存在")
+
+//OverwriteSkip时，目标已存在返回ErrSkipped，表示没有写入任何内容
+var ErrSkipped = errors.New("目标文件已存在，已跳过")
+
+func (m OverwriteMode) String() string {
+	switch m {
+	case OverwriteFail:
+		return "OverwriteFail"
+	case OverwriteReplace:
+		return "OverwriteReplace"
+	case OverwriteSkip:
+		return "OverwriteSkip"
+	case OverwriteNewer:
+		return "OverwriteNewer"
+	}
+	return "OverwriteMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+//把旧的failIfExist参数转换为OverwriteMode
+func overwriteMode(failIfExist bool) OverwriteMode {
+	if failIfExist {
+		return OverwriteFail
+	}
+	return OverwriteReplace
+}
+
+//设置解压时目标位置已经有文件的处理方式，默认是OverwriteReplace，和以前一样覆盖
+//OverwriteFail时这一项返回包装了ErrExist的错误，按WithErrorPolicy处理；OverwriteSkip时保留已存在的文件；
+//OverwriteNewer时比较修改时间，保留较新的一方。跳过的项记录WarnExisting类别的警告，并计入Stats.SkippedExisting
+//已存在的目录不算冲突；同一个压缩包中重复的项仍然是后面的覆盖前面的
+func WithExtractOverwrite(mode OverwriteMode) Option {
+	return func(o *options) error {
+		switch mode {
+		case OverwriteFail, OverwriteReplace, OverwriteSkip, OverwriteNewer:
+		default:
+			return fmt.Errorf("不支持的覆盖方式：%v", mode)
+		}
+		o.extractOverwrite = mode
+		return nil
+	}
+}
+
+//解压hdr之前检查dstFile是否已经存在，返回true表示保留已存在的文件、跳过这一项
+func (u *unpacker) conflict(dstFile string, hdr *tar.Header) (bool, error) {
+	mode := u.opts.extractOverwrite
+	if mode == OverwriteReplace {
+		return false, nil
+	}
+	if u.created[dstFile] {
+		return false, nil
+	}
+	u.created[dstFile] = true
+	fi, err := os.Lstat(dstFile)
+	if err != nil {
+		return false, nil
+	}
+
+	switch mode {
+	case OverwriteFail:
+		return false, fmt.Errorf("%w：%s", ErrExist, dstFile)
+	case OverwriteNewer:
+		if hdr.ModTime.After(fi.ModTime()) {
+			return false, nil
+		}
+		u.warn(hdr.Name, WarnExisting, errors.New("已存在的文件不比包内的旧，已保留"))
+	default:
+		u.warn(hdr.Name, WarnExisting, errors.New("目标位置已经有文件，已跳过"))
+	}
+	u.stats.SkippedExisting++
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package targz
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+//两个打包同时生成同一个dest，不覆盖时只有一个能成功，另一个返回ErrExist或者ErrSkipped
+func TestTarExclusiveRace(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "b/c.txt": "c"})
+
+	for _, mode := range []OverwriteMode{OverwriteFail, OverwriteSkip} {
+		for round := 0; round < 20; round++ {
+			dest := filepath.Join(t.TempDir(), "out.tar.gz")
+			var start, done sync.WaitGroup
+			start.Add(1)
+			errs := make([]error, 2)
+			for i := range errs {
+				done.Add(1)
+				go func(i int) {
+					defer done.Done()
+					start.Wait()
+					errs[i] = TarWithOptions(src, dest, WithOverwriteMode(mode))
+				}(i)
+			}
+			start.Done()
+			done.Wait()
+
+			won := 0
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					won++
+				case mode == OverwriteFail && errors.Is(err, ErrExist):
+				case mode == OverwriteSkip && errors.Is(err, ErrSkipped):
+				default:
+					t.Fatalf("模式%v返回了%v", mode, err)
+				}
+			}
+			if won != 1 {
+				t.Fatalf("模式%v有%d个打包成功", mode, won)
+			}
+			if got := archiveNames(t, dest); len(got) != 3 {
+				t.Fatalf("dest中的项是%v", got)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package targz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+//并行压缩时每一块的大小
+const parallelGzipBlockSize = 1 << 20
+
+//并行的gzip写入器
+//写入的数据按parallelGzipBlockSize切成块，每块在单独的goroutine中压缩成一个完整的gzip成员，
+//再按顺序写入w，多个gzip成员首尾相接仍然是标准的gzip数据，gzip、tar -xzf都可以直接解压
+//同时在处理中的块最多为workers个，所以内存占用约为workers×块大小
+type parallelGzipWriter struct {
+	w      io.Writer
+	level  int
+	header gzip.Header //只写入第一个gzip成员的头中
+	pool   sync.Pool   //复用gzip.Writer
+
+	buf     []byte            //正在填充的块
+	queue   chan chan gzBlock //按顺序排队等待写出的块
+	done    chan struct{}     //写出的goroutine结束时关闭
+	written bool              //是否已经发出过块
+
+	mu  sync.Mutex
+	err error //压缩或者写出时遇到的第一个错误
+}
+
+//压缩完成的块
+type gzBlock struct {
+	data []byte
+	err  error
+}
+
+func newParallelGzipWriter(w io.Writer, level int, workers int, header gzip.Header) (*parallelGzipWriter, error) {
+	//提前检查压缩级别，避免在goroutine中才出错
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+
+	z := &parallelGzipWriter{
+		w:      w,
+		level:  level,
+		header: header,
+		buf:    make([]byte, 0, parallelGzipBlockSize),
+		queue:  make(chan chan gzBlock, workers),
+		done:   make(chan struct{}),
+	}
+	z.pool.New = func() interface{} {
+		gw, _ := gzip.NewWriterLevel(nil, level)
+		return gw
+	}
+
+	go z.writeLoop()
+	return z, nil
+}
+
+func (z *parallelGzipWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if err := z.firstErr(); err != nil {
+			return n, err
+		}
+
+		m := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+m]
+		n += m
+		p = p[m:]
+
+		if len(z.buf) == cap(z.buf) {
+			z.dispatch()
+		}
+	}
+	return n, nil
+}
+
+//压缩剩余的数据并等待所有块写出，不会关闭底层的w
+func (z *parallelGzipWriter) Close() error {
+	//一个字节都没有写入时也要输出一个空的gzip成员，保证结果是合法的gzip数据
+	if len(z.buf) > 0 || !z.written {
+		z.dispatch()
+	}
+	close(z.queue)
+	<-z.done
+	return z.firstErr()
+}
+
+//把当前块交给新的goroutine压缩，队列满时会阻塞，以此限制内存占用
+func (z *parallelGzipWriter) dispatch() {
+	block := z.buf
+	first := !z.written
+	z.buf = make([]byte, 0, parallelGzipBlockSize)
+	z.written = true
+
+	ch := make(chan gzBlock, 1)
+	z.queue <- ch
+	go func() {
+		ch <- z.compress(block, first)
+	}()
+}
+
+func (z *parallelGzipWriter) compress(block []byte, first bool) gzBlock {
+	var out bytes.Buffer
+	gw := z.pool.Get().(*gzip.Writer)
+	defer z.pool.Put(gw)
+
+	gw.Reset(&out)
+	if first {
+		gw.Header = z.header
+	}
+	if _, err := gw.Write(block); err != nil {
+		return gzBlock{err: err}
+	}
+	if err := gw.Close(); err != nil {
+		return gzBlock{err: err}
+	}
+	return gzBlock{data: out.Bytes()}
+}
+
+//按顺序把压缩好的块写入w，出错后只消费剩余的块而不再写出
+func (z *parallelGzipWriter) writeLoop() {
+	defer close(z.done)
+
+	for ch := range z.queue {
+		block := <-ch
+		if z.firstErr() != nil {
+			continue
+		}
+
+		err := block.err
+		if err == nil {
+			_, err = z.w.Write(block.data)
+		}
+		if err != nil {
+			z.mu.Lock()
+			z.err = err
+			z.mu.Unlock()
+		}
+	}
+}
+
+func (z *parallelGzipWriter) firstErr() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
@@ -0,0 +1,65 @@
+package targz
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+//打包计划中的一项，对应包中的一个tar头
+type Entry struct {
+	Name     string      //包内的名称，目录以`/`结尾
+	Size     int64       //内容的字节数，目录、链接等没有内容的项为0
+	Mode     os.FileMode //权限和文件类型
+	Typeflag byte        //tar头的类型，例如tar.TypeReg、tar.TypeDir
+	Linkname string      //符号链接或者硬链接的目标
+
+	MetadataOnly bool //WithMetadataOnly打包的普通文件，包中没有内容，Size是原来的大小
+}
+
+//根据tar头生成Entry
+func newEntry(hdr *tar.Header) Entry {
+	e := Entry{
+		Name:     hdr.Name,
+		Size:     hdr.Size,
+		Mode:     hdr.FileInfo().Mode(),
+		Typeflag: hdr.Typeflag,
+		Linkname: hdr.Linkname,
+	}
+	if size, ok := metadataOnlySize(hdr); ok {
+		e.Size, e.MetadataOnly = size, true
+	}
+	return e
+}
+
+//按照和Tar完全相同的遍历和过滤规则，列出打包src时会写入的所有项，但不读取文件内容，也不创建任何文件
+//opts和Tar的选项相同，与写入无关的选项（例如压缩级别）会被忽略
+//将所有项的Size相加就是打包时要写入的数据总量，可以用来估算进度
+func Plan(src string, opts ...Option) ([]Entry, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return nil, errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	//不设置tar.Writer，packer只记录tar头而不写入
+	p := newPacker(context.Background(), nil, o)
+	p.dryRun = true
+	if p.snap, err = loadSnapshot(o); err != nil {
+		return nil, err
+	}
+	if err := p.tarSrc(src); err != nil {
+		return nil, err
+	}
+	if err := p.tarExtras(); err != nil {
+		return nil, err
+	}
+	return p.entries, nil
+}
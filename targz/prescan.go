@@ -0,0 +1,59 @@
+package targz
+
+import (
+	"context"
+)
+
+//打包之前先按同样的规则遍历一遍，只读取文件信息，统计要写入的总字节数和总项数，
+//填写在每次回调的ProgressInfo.ExpectedBytes和ExpectedEntries中，用于计算百分比和剩余时间
+//排除、过滤、大小限制等规则和正式打包完全相同，跳过的文件不会计入；只有同时设置了WithProgress时才会遍历
+//遍历期间目录发生变化时，实际写入的数量可能和预计的不同；对延迟敏感时不要使用这个选项
+func WithPrescan() Option {
+	return func(o *options) error {
+		o.prescan = true
+		return nil
+	}
+}
+
+//完成的比例，从0到1：预计的字节数不为0时按字节计算，否则按项数计算；没有使用WithPrescan时为0
+func (pi ProgressInfo) Percent() float64 {
+	var p float64
+	switch {
+	case pi.ExpectedBytes > 0:
+		p = float64(pi.TotalBytes) / float64(pi.ExpectedBytes)
+	case pi.ExpectedEntries > 0:
+		p = float64(pi.Entries) / float64(pi.ExpectedEntries)
+	}
+	//遍历之后新增的内容会使实际的数量超过预计
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+//用dryRun的packer执行一遍walk，返回会写入的文件内容总字节数和总项数
+func prescan(ctx context.Context, o *options, walk func(p *packer) error) (int64, int, error) {
+	//预先遍历时不记录日志，跳过的项在正式打包时才记录
+	po := *o
+	po.logger = nil
+
+	snap, err := loadSnapshot(&po)
+	if err != nil {
+		return 0, 0, err
+	}
+	p := newPacker(ctx, nil, &po)
+	p.dryRun, p.snap = true, snap
+	err = walk(p)
+	if err == nil {
+		err = p.tarExtras()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var bytes int64
+	for _, e := range p.entries {
+		bytes += e.Size
+	}
+	return bytes, len(p.entries), nil
+}
@@ -0,0 +1,74 @@
+package targz
+
+import (
+	"archive/tar"
+	"io"
+)
+
+//复制大文件时每写入这么多字节报告一次进度
+const progressInterval = 1 << 20
+
+//打包的进度，通过WithProgress设置的回调函数获得
+type ProgressInfo struct {
+	Name       string //当前项在包内的名称
+	EntryBytes int64  //当前项已经写入的字节数
+	TotalBytes int64  //所有项累计写入的字节数，未压缩
+	Entries    int    //已经完成的项数，包括文件、目录和链接
+
+	ExpectedBytes   int64 //WithPrescan时预计要写入的总字节数，未压缩，否则为0
+	ExpectedEntries int   //WithPrescan时预计的总项数，否则为0
+}
+
+//打包时的进度状态
+type progress struct {
+	fn       func(ProgressInfo)
+	info     ProgressInfo
+	inEntry  bool  //当前项是否还没有完成
+	reported int64 //当前项上一次报告时已经写入的字节数
+}
+
+//开始一项，没有内容的项直接完成
+func (pg *progress) start(hdr *tar.Header) {
+	if pg.fn == nil {
+		return
+	}
+	pg.info.Name = hdr.Name
+	pg.info.EntryBytes = 0
+	pg.reported = 0
+	pg.inEntry = true
+	if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 {
+		pg.end()
+	}
+}
+
+//完成当前项，每一项只报告一次
+func (pg *progress) end() {
+	if pg.fn == nil || !pg.inEntry {
+		return
+	}
+	pg.inEntry = false
+	pg.info.Entries++
+	pg.fn(pg.info)
+}
+
+//记录写入了n个字节，累计超过progressInterval时报告一次
+func (pg *progress) add(n int) {
+	pg.info.EntryBytes += int64(n)
+	pg.info.TotalBytes += int64(n)
+	if pg.info.EntryBytes-pg.reported >= progressInterval {
+		pg.reported = pg.info.EntryBytes
+		pg.fn(pg.info)
+	}
+}
+
+//统计写入字节数的io.Writer
+type progressWriter struct {
+	w  io.Writer
+	pg *progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.pg.add(n)
+	return n, err
+}
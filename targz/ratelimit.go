@@ -0,0 +1,111 @@
+package targz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+//限速时每次读写的最大字节数，和io.Copy的缓冲区一样大
+const rateChunkSize = 32 * 1024
+
+//限制打包时读取文件内容和解压时写入文件内容的总速度，单位是字节每秒，0表示不限制
+//同一次打包或者解压的所有文件共用一个限额，空闲后最多允许1秒的突发
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(o *options) error {
+		if bytesPerSec < 0 {
+			return fmt.Errorf("速度限制不能为负数：%d", bytesPerSec)
+		}
+		o.rateLimit = bytesPerSec
+		return nil
+	}
+}
+
+//令牌桶限速，在一次打包或者解压中共用
+type rateLimiter struct {
+	ctx   context.Context
+	rate  int64     //每秒字节数
+	start time.Time //计算额度的起点
+	n     int64     //从start开始已经通过的字节数
+}
+
+//rate为0时返回nil，表示不限速
+func newRateLimiter(ctx context.Context, rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{ctx: ctx, rate: rate}
+}
+
+//记录通过了n字节，超出额度时等待，等待期间ctx取消时返回错误
+func (l *rateLimiter) wait(n int) error {
+	now := time.Now()
+	if l.start.IsZero() {
+		l.start = now
+	}
+	l.n += int64(n)
+
+	due := l.start.Add(time.Duration(float64(l.n) / float64(l.rate) * float64(time.Second)))
+	d := due.Sub(now)
+	if d <= 0 {
+		//空闲太久时重新计算，避免积累的额度造成很长的突发
+		if d < -time.Second {
+			l.start, l.n = now.Add(-time.Second), l.rate
+		}
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+}
+
+//限速的io.Writer
+type rateWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+func (w *rateWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > rateChunkSize {
+			chunk = chunk[:rateChunkSize]
+		}
+		m, err := w.w.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if err := w.l.wait(m); err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+//限速的io.Reader
+type rateReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r *rateReader) Read(p []byte) (int, error) {
+	if len(p) > rateChunkSize {
+		p = p[:rateChunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
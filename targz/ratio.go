@@ -0,0 +1,141 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"sort"
+	"strings"
+)
+
+//一项在压缩包中的压缩效果，见WithEntryRatio
+type EntryRatio struct {
+	Name            string //包内的名称，目录以`/`结尾
+	Size            int64  //文件内容的字节数
+	TarBytes        int64  //压缩前这一项在tar中占用的字节数，包括tar头和补齐的0
+	CompressedBytes int64  //压缩后这一项占用的字节数
+}
+
+//压缩后和压缩前的比例，接近1说明几乎无法压缩
+func (r EntryRatio) Ratio() float64 {
+	if r.TarBytes == 0 {
+		return 0
+	}
+	return float64(r.CompressedBytes) / float64(r.TarBytes)
+}
+
+//每写完一项调用fn报告它压缩前后的大小，用于找出不值得压缩、下次应该排除或者单独存放的内容
+//为了得到准确的数字，每一项结束时都会Flush压缩格式，压缩包会稍大一些；
+//不支持Flush的格式（例如xz、bzip2）按写出的字节计算，压缩器缓冲的数据会计入之后的项
+//不能和WithParallelGzip同时使用；只用于生成压缩包的Tar、TarToWriter、NewWriter等函数，不用于Append
+func WithEntryRatio(fn func(EntryRatio)) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return errors.New("WithEntryRatio的回调函数不能为nil")
+		}
+		o.entryRatio = fn
+		return nil
+	}
+}
+
+//按目录汇总EntryRatio，可以直接把Add作为WithEntryRatio的回调
+//
+//	var s targz.RatioSummary
+//	err := targz.TarWithOptions(src, dest, targz.WithEntryRatio(s.Add))
+//	for _, d := range s.Dirs() { fmt.Printf("%s %.1f%%\n", d.Name, d.Ratio()*100) }
+type RatioSummary struct {
+	dirs map[string]*EntryRatio
+}
+
+//把r计入它所在的各层目录，目录本身的tar头计入自己
+func (s *RatioSummary) Add(r EntryRatio) {
+	if s.dirs == nil {
+		s.dirs = make(map[string]*EntryRatio)
+	}
+	name := strings.TrimSuffix(r.Name, "/")
+	end := len(name)
+	if !strings.HasSuffix(r.Name, "/") {
+		end = strings.LastIndex(name, "/")
+	}
+	for end > 0 {
+		dir := name[:end] + "/"
+		d := s.dirs[dir]
+		if d == nil {
+			d = &EntryRatio{Name: dir}
+			s.dirs[dir] = d
+		}
+		d.Size += r.Size
+		d.TarBytes += r.TarBytes
+		d.CompressedBytes += r.CompressedBytes
+		end = strings.LastIndex(name[:end], "/")
+	}
+}
+
+//所有目录的汇总，压缩效果最差的在前
+func (s *RatioSummary) Dirs() []EntryRatio {
+	dirs := make([]EntryRatio, 0, len(s.dirs))
+	for _, d := range s.dirs {
+		dirs = append(dirs, *d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if ri, rj := dirs[i].Ratio(), dirs[j].Ratio(); ri != rj {
+			return ri > rj
+		}
+		return dirs[i].Name < dirs[j].Name
+	})
+	return dirs
+}
+
+//在每一项的边界统计压缩前后的字节数
+type ratioTracker struct {
+	fn    func(EntryRatio)
+	tw    *tar.Writer
+	flush func() error    //压缩格式的Flush，不支持时为nil
+	raw   *countingWriter //压缩前的字节数
+	out   *countingWriter //压缩后的字节数
+
+	cur                EntryRatio
+	rawStart, outStart int64
+	active             bool //cur还没有报告
+}
+
+//和newTarGzWriter相同，同时在tar和压缩之间统计字节数
+func newRatioTarWriter(cw *countingWriter, o *options) (*tar.Writer, func() error, *ratioTracker, error) {
+	gw, err := newCompressStream(cw, o)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r := &ratioTracker{fn: o.entryRatio, raw: &countingWriter{w: gw}, out: cw}
+	if f, ok := gw.(interface{ Flush() error }); ok {
+		r.flush = f.Flush
+	}
+	r.tw = tar.NewWriter(r.raw)
+	return r.tw, closeTarGz(r.tw, gw), r, nil
+}
+
+//结束上一项并报告，hdr不为nil时开始统计新的一项
+func (r *ratioTracker) next(hdr *tar.Header) error {
+	if r.active {
+		//写出上一项补齐的0和压缩器中缓冲的数据
+		if err := r.tw.Flush(); err != nil {
+			return err
+		}
+		if r.flush != nil {
+			if err := r.flush(); err != nil {
+				return err
+			}
+		}
+		r.cur.TarBytes = r.raw.n - r.rawStart
+		r.cur.CompressedBytes = r.out.n - r.outStart
+		r.active = false
+		r.fn(r.cur)
+	}
+	if hdr != nil {
+		r.cur = EntryRatio{Name: hdr.Name}
+		if hdr.Typeflag == tar.TypeReg {
+			r.cur.Size = hdr.Size
+		}
+		r.rawStart, r.outStart = r.raw.n, r.out.n
+		r.active = true
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package targz
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+//打包时把指向打包的目录之内的绝对路径符号链接改写为相对路径，例如app/lib/libfoo.so -> /home/ci/build/app/lib/libfoo.so.1
+//改写为libfoo.so.1，解压到其他位置、其他机器上仍然有效；指向目录之外的绝对路径保持不变，warnExternal为true时同时记录警告
+//打包目录之内是指同一个源之内，TarAll等多个源之间的链接按指向之外处理；磁盘上的链接不会被修改
+func WithRelativeSymlinks(warnExternal bool) Option {
+	return func(o *options) error {
+		o.relativeLinks = true
+		o.warnExternalLinks = warnExternal
+		return nil
+	}
+}
+
+//WithRelativeSymlinks时改写绝对路径的链接目标，srcFull是链接在磁盘上的路径，不需要改写时原样返回
+func (p *packer) relativeLink(srcBase string, srcFull string, srcRelative string, link string) string {
+	if !p.opts.relativeLinks || !filepath.IsAbs(link) {
+		return link
+	}
+	target := filepath.Clean(link)
+
+	//打包的目录树在磁盘上的位置，源本身是目录且保留了顶层目录时是源目录，否则是srcBase
+	root, err := filepath.Abs(filepath.Join(srcBase, p.srcRoot))
+	if err == nil {
+		if rel, ok := linkInside(root, srcFull, target); ok {
+			return rel
+		}
+		//源的路径中有符号链接时，链接目标可能写的是解析之后的路径，例如macOS的/tmp和/private/tmp
+		if real, err := filepath.EvalSymlinks(root); err == nil && real != root {
+			dir, _ := filepath.Abs(filepath.Dir(srcFull))
+			if realDir, err := filepath.Rel(root, dir); err == nil {
+				if rel, ok := linkInside(real, filepath.Join(real, realDir, filepath.Base(srcFull)), target); ok {
+					return rel
+				}
+			}
+		}
+	}
+	if p.opts.warnExternalLinks {
+		p.warn(filepath.ToSlash(srcRelative), WarnExternalLink, errors.New("符号链接指向打包的目录之外："+link))
+	}
+	return link
+}
+
+//target在root之内时返回从链接所在目录到target的相对路径
+func linkInside(root string, linkPath string, target string) (string, bool) {
+	inRoot, err := filepath.Rel(root, target)
+	if err != nil || inRoot == ".." || strings.HasPrefix(inRoot, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	linkDir, err := filepath.Abs(filepath.Dir(linkPath))
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(linkDir, target)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
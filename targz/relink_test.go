@@ -0,0 +1,97 @@
+//go:build unix
+
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//WithRelativeSymlinks把指向打包的目录之内的绝对路径链接改写为相对路径，包括同级目录之间和顶层的链接
+func TestRelativeSymlinks(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "app")
+	writeTree(t, src, map[string]string{"lib/libfoo.so.1": "foo", "bin/run": "run"})
+	links := map[string]string{
+		"bin/foo": filepath.Join(src, "lib", "libfoo.so.1"), //同级目录之间
+		"foo":     filepath.Join(src, "lib", "libfoo.so.1"), //顶层
+		"libdir":  filepath.Join(src, "lib"),
+		"self":    src,
+		"ext":     "/etc/hosts",
+		"rel":     "lib/libfoo.so.1",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	linknames := func(opts ...Option) map[string]string {
+		entries, err := Plan(src, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, e := range entries {
+			if e.Linkname != "" {
+				got[e.Name] = e.Linkname
+			}
+		}
+		return got
+	}
+	want := map[string]string{
+		"bin/foo": "../lib/libfoo.so.1",
+		"foo":     "lib/libfoo.so.1",
+		"libdir":  "lib",
+		"self":    ".",
+		"ext":     "/etc/hosts",
+		"rel":     "lib/libfoo.so.1",
+	}
+	if got := linknames(WithRelativeSymlinks(false)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("改写后的链接是%v，应为%v", got, want)
+	}
+	//保留顶层目录时同样按源目录判断
+	withBase := make(map[string]string)
+	for name, link := range want {
+		withBase["app/"+name] = link
+	}
+	if got := linknames(WithRelativeSymlinks(false), WithKeepBaseDir()); !reflect.DeepEqual(got, withBase) {
+		t.Fatalf("WithKeepBaseDir时改写后的链接是%v，应为%v", got, withBase)
+	}
+
+	//指向之外的链接只在warnExternal为true时记录警告
+	for _, warn := range []bool{false, true} {
+		var stats Stats
+		if _, err := TarBytes(src, WithRelativeSymlinks(warn), WithStats(&stats)); err != nil {
+			t.Fatal(err)
+		}
+		var external []string
+		for _, w := range stats.Warnings {
+			if w.Category == WarnExternalLink {
+				external = append(external, w.Name)
+			}
+		}
+		if warn && !reflect.DeepEqual(external, []string{"ext"}) || !warn && len(external) != 0 {
+			t.Fatalf("warnExternal为%v时的警告是%v", warn, external)
+		}
+	}
+
+	//源目录删除之后，解压出的链接仍然有效
+	data, err := TarBytes(src, WithRelativeSymlinks(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	if err := UnTarBytes(data, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bin/foo", "foo", "libdir/libfoo.so.1"} {
+		if b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name))); err != nil || string(b) != "foo" {
+			t.Fatalf("%s：%q %v", name, b, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package targz
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+const (
+	rsyncWindow   = 4096 //滚动和的窗口大小，和gzip --rsyncable一致
+	rsyncMinChunk = 4096 //两个分界点之间的最小距离，避免连续的0（tar的填充）造成过多的分界点
+)
+
+//生成对rsync友好的gzip数据，和gzip --rsyncable的思路一样：
+//按最近4KB数据的滚动和确定分界点，每个分界点开始一个新的gzip成员，和之前的数据完全无关，
+//所以源文件只有少量改动时，改动以外的压缩数据保持不变，rsync只需要传输改动附近的部分
+//多个gzip成员首尾相接仍然是标准的gzip数据；代价是压缩后的大小会增加，4MB的文本数据约增加0.7%，越容易压缩的数据增加得越多
+//只能用于gzip格式，不能和WithParallelGzip同时使用
+func WithRsyncable() Option {
+	return func(o *options) error {
+		o.rsyncable = true
+		return nil
+	}
+}
+
+//在内容决定的分界点重新开始gzip成员的写入器
+type rsyncableWriter struct {
+	w  io.Writer
+	gw *gzip.Writer
+
+	window [rsyncWindow]byte //最近写入的数据，环形缓冲
+	pos    int               //window中下一个写入的位置
+	sum    uint32            //window中所有字节的和
+	chunk  int               //距离上一个分界点的字节数
+}
+
+func newRsyncableWriter(w io.Writer, level int, header gzip.Header) (*rsyncableWriter, error) {
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	gw.Header = header
+	return &rsyncableWriter{w: w, gw: gw}, nil
+}
+
+func (z *rsyncableWriter) Write(p []byte) (n int, err error) {
+	start := 0
+	for i, b := range p {
+		z.sum += uint32(b) - uint32(z.window[z.pos])
+		z.window[z.pos] = b
+		z.pos = (z.pos + 1) % rsyncWindow
+		z.chunk++
+
+		if z.chunk >= rsyncMinChunk && z.sum%rsyncWindow == 0 {
+			m, err := z.gw.Write(p[start : i+1])
+			n += m
+			if err != nil {
+				return n, err
+			}
+			start = i + 1
+			if err := z.restart(); err != nil {
+				return n, err
+			}
+		}
+	}
+	m, err := z.gw.Write(p[start:])
+	return n + m, err
+}
+
+//结束当前的gzip成员，开始一个新的成员，头中的信息只保留在第一个成员中
+func (z *rsyncableWriter) restart() error {
+	if err := z.gw.Close(); err != nil {
+		return err
+	}
+	z.gw.Reset(z.w)
+	z.chunk = 0
+	return nil
+}
+
+//结束最后一个gzip成员，不会关闭底层的w
+func (z *rsyncableWriter) Close() error {
+	return z.gw.Close()
+}
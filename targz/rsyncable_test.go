@@ -0,0 +1,81 @@
+package targz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+//生成n字节左右的伪文本，压缩率和源代码差不多
+func pseudoText(n int) []byte {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"alpha ", "beta ", "gamma ", "delta\n", "func ", "return ", "package ", "{ ", "} "}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[r.Intn(len(words))])
+		if r.Intn(50) == 0 {
+			buf.WriteByte(byte('a' + r.Intn(26)))
+		}
+	}
+	return buf.Bytes()
+}
+
+//WithRsyncable的输出是标准的gzip数据，源文件开头有少量改动时，之后的压缩数据保持不变
+//4MB伪文本的大小增加不到1%，见日志
+func TestRsyncable(t *testing.T) {
+	text := pseudoText(4 << 20)
+	tarText := func(content []byte, opts ...Option) []byte {
+		src := t.TempDir()
+		if err := os.WriteFile(filepath.Join(src, "text"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(t.TempDir(), "out.tar.gz")
+		if err := TarWithOptions(src, dest, append(opts, WithDeterministic())...); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	plain, rsyncable := tarText(text), tarText(text, WithRsyncable())
+	overhead := float64(len(rsyncable)-len(plain)) * 100 / float64(len(plain))
+	t.Logf("普通%d字节，WithRsyncable %d字节，增加%.2f%%", len(plain), len(rsyncable), overhead)
+	if overhead > 1 {
+		t.Errorf("大小增加了%.2f%%", overhead)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(rsyncable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, gr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.LookPath("gzip"); err == nil {
+		cmd := exec.Command("gzip", "-t")
+		cmd.Stdin = bytes.NewReader(rsyncable)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("gzip -t失败：%s", out)
+		}
+	}
+
+	//在开头插入512字节，tar末尾的填充不变，之后的压缩数据绝大部分不变
+	modified := append(append(append([]byte{}, text[:1000]...), bytes.Repeat([]byte("INSERTED"), 64)...), text[1000:]...)
+	changed := tarText(modified, WithRsyncable())
+	same := 0
+	for same < len(rsyncable) && same < len(changed) && rsyncable[len(rsyncable)-1-same] == changed[len(changed)-1-same] {
+		same++
+	}
+	t.Logf("%d字节中末尾的%d字节相同", len(rsyncable), same)
+	if same < len(rsyncable)*9/10 {
+		t.Fatalf("只有末尾的%d字节相同", same)
+	}
+}
@@ -0,0 +1,220 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//把src打包为shards个大小接近的压缩包，返回按编号排列的所有压缩包，适合按压缩包并行恢复
+//destPattern中含有`%`时作为fmt的格式，编号从0开始，例如"out-%02d.tar.gz"；否则在文件名的第一个`.`之前加上-00、-01……
+//先按和Tar相同的规则遍历一遍，再把文件按从大到小的顺序依次分给当前最小的压缩包，每个文件只出现在一个压缩包中；
+//文件所在的各层目录在每个需要它们的压缩包中重复写入，每个压缩包都可以单独解压；空目录放在第一个压缩包中
+//遍历之后新出现的文件不会打包；WithExtraEntry的项只写入第一个压缩包，不能和WithSnapshot同时使用
+//需要查看每个压缩包的大小时使用WithShardStats；失败时删除已经生成的所有压缩包
+func TarSharded(src string, destPattern string, shards int, opts ...Option) (parts []string, err error) {
+	if shards <= 0 {
+		return nil, errors.New("压缩包的个数必须大于0")
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.snapshot != "" {
+		return nil, errors.New("TarSharded不能和WithSnapshot同时使用")
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return nil, errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	plan, err := planShards(src, o, shards)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil && !isPartial(err) {
+			for _, part := range parts {
+				os.Remove(part)
+			}
+			parts = nil
+		}
+	}()
+	stats := make([]Stats, shards)
+	if o.shardStats != nil {
+		defer func() {
+			*o.shardStats = stats
+		}()
+	}
+	//ContinueOnError时各个压缩包中出错的项合并为一个*MultiError
+	var failed []*EntryError
+	for i := 0; i < shards; i++ {
+		name := shardName(destPattern, i)
+		so, err := newOptions(opts)
+		if err != nil {
+			return parts, err
+		}
+		so.srcForm(src)
+		so.stats = &stats[i]
+		if i > 0 {
+			so.extras = nil
+		}
+		err = tarShard(src, name, so, plan.filter(i))
+		if err == nil || isPartial(err) {
+			parts = append(parts, name)
+		}
+		var me *MultiError
+		if errors.As(err, &me) {
+			failed = append(failed, me.Errors...)
+		} else if err != nil {
+			return parts, fmt.Errorf("生成%s失败：%w", name, err)
+		}
+	}
+	return parts, multiError(failed)
+}
+
+//TarSharded时得到每个压缩包的统计信息，按编号排列
+func WithShardStats(stats *[]Stats) Option {
+	return func(o *options) error {
+		o.shardStats = stats
+		return nil
+	}
+}
+
+//第i个压缩包的文件名
+func shardName(pattern string, i int) string {
+	if strings.Contains(pattern, "%") {
+		return fmt.Sprintf(pattern, i)
+	}
+	dir, base := filepath.Split(pattern)
+	if dot := strings.Index(base, "."); dot > 0 {
+		return dir + fmt.Sprintf("%s-%02d%s", base[:dot], i, base[dot:])
+	}
+	return fmt.Sprintf("%s-%02d", pattern, i)
+}
+
+//生成一个压缩包，只打包filter允许的项
+func tarShard(src string, dest string, o *options, filter *shardFilter) (err error) {
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+	return tarToWriter(context.Background(), d.f, o, func(p *packer) error {
+		p.shard = filter
+		return p.tarSrc(src)
+	})
+}
+
+//遍历一遍，把文件分配到各个压缩包
+type shardPlan struct {
+	files map[string]int    //文件所在的压缩包
+	dirs  []map[string]bool //每个压缩包中需要写入的目录
+}
+
+//记录遍历到的一项，键为去掉了结尾`/`的相对路径
+type shardItem struct {
+	key  string
+	size int64
+}
+
+func planShards(src string, o *options, shards int) (*shardPlan, error) {
+	rec := &shardFilter{record: true}
+	p := newPacker(context.Background(), nil, o)
+	p.dryRun = true
+	p.shard = rec
+	if err := p.tarSrc(src); err != nil {
+		return nil, err
+	}
+
+	//从大到小依次放入当前最小的压缩包，大小相同时按名称，结果是确定的
+	sort.Slice(rec.files, func(i, j int) bool {
+		if rec.files[i].size != rec.files[j].size {
+			return rec.files[i].size > rec.files[j].size
+		}
+		return rec.files[i].key < rec.files[j].key
+	})
+	plan := &shardPlan{files: make(map[string]int), dirs: make([]map[string]bool, shards)}
+	for i := range plan.dirs {
+		plan.dirs[i] = make(map[string]bool)
+	}
+	totals := make([]int64, shards)
+	for _, f := range rec.files {
+		smallest := 0
+		for i := range totals {
+			if totals[i] < totals[smallest] {
+				smallest = i
+			}
+		}
+		totals[smallest] += f.size
+		plan.files[f.key] = smallest
+		plan.addDir(smallest, path.Dir(f.key))
+	}
+
+	//没有分到文件的目录放在第一个压缩包中
+	used := make(map[string]bool)
+	for _, dirs := range plan.dirs {
+		for dir := range dirs {
+			used[dir] = true
+		}
+	}
+	for _, dir := range rec.dirs {
+		if !used[dir] {
+			plan.addDir(0, dir)
+		}
+	}
+	return plan, nil
+}
+
+//在第i个压缩包中写入dir及其各层上级目录
+func (s *shardPlan) addDir(i int, dir string) {
+	for dir != "." && dir != "/" && !s.dirs[i][dir] {
+		s.dirs[i][dir] = true
+		dir = path.Dir(dir)
+	}
+}
+
+func (s *shardPlan) filter(i int) *shardFilter {
+	return &shardFilter{index: i, plan: s}
+}
+
+//TarSharded时决定一项是否写入正在生成的压缩包
+type shardFilter struct {
+	record bool //遍历阶段，只记录不跳过
+	files  []shardItem
+	dirs   []string
+
+	index int
+	plan  *shardPlan
+}
+
+//判断srcRelative是否属于这个压缩包
+func (f *shardFilter) keep(srcRelative string, fi os.FileInfo) bool {
+	key := strings.TrimSuffix(filepath.ToSlash(srcRelative), "/")
+	if f.record {
+		if fi.IsDir() {
+			f.dirs = append(f.dirs, key)
+		} else {
+			f.files = append(f.files, shardItem{key: key, size: fi.Size()})
+		}
+		return true
+	}
+	if fi.IsDir() {
+		return f.plan.dirs[f.index][key]
+	}
+	i, ok := f.plan.files[key]
+	return ok && i == f.index
+}
@@ -0,0 +1,78 @@
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//WithTrailingSlash和WithKeepBaseDir、WithRootEntry、WithStripPrefix、WithAddPrefix的各种组合
+func TestTrailingSlash(t *testing.T) {
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app")
+	writeTree(t, app, map[string]string{"conf/a.yml": "a"})
+	sep := string(filepath.Separator)
+	contents := []string{"conf/", "conf/a.yml"}
+	withBase := []string{"app/", "app/conf/", "app/conf/a.yml"}
+
+	cases := []struct {
+		src  string
+		opts []Option
+		want []string
+	}{
+		{app, nil, withBase},
+		{app + sep, nil, contents},
+		{app + sep + ".", nil, contents},
+		{app, []Option{WithKeepBaseDir()}, withBase},
+		{app + sep, []Option{WithKeepBaseDir()}, contents},
+		{app, []Option{WithRootEntry()}, withBase},
+		{app + sep, []Option{WithRootEntry()}, []string{"./", "conf/", "conf/a.yml"}},
+		{app, []Option{WithRootEntry(), WithKeepBaseDir()}, withBase},
+		{app + sep, []Option{WithRootEntry(), WithKeepBaseDir()}, []string{"./", "conf/", "conf/a.yml"}},
+		{app, []Option{WithStripPrefix("app")}, []string{"./", "conf/", "conf/a.yml"}},
+		{app + sep, []Option{WithStripPrefix("conf")}, []string{"./", "a.yml"}},
+		{app, []Option{WithAddPrefix("x")}, []string{"x/app/", "x/app/conf/", "x/app/conf/a.yml"}},
+		{app + sep, []Option{WithAddPrefix("x")}, []string{"x/conf/", "x/conf/a.yml"}},
+		{app + sep, []Option{WithRootEntry(), WithAddPrefix("x")}, []string{"x/", "x/conf/", "x/conf/a.yml"}},
+		{app, []Option{WithStripPrefix("app"), WithAddPrefix("x")}, []string{"x/", "x/conf/", "x/conf/a.yml"}},
+		//src是文件时没有区别
+		{filepath.Join(app, "conf", "a.yml"), nil, []string{"a.yml"}},
+		{filepath.Join(app, "conf", "a.yml"), []Option{WithKeepBaseDir()}, []string{"a.yml"}},
+	}
+	for _, c := range cases {
+		got := planNames(t, c.src, append(c.opts, WithTrailingSlash())...)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q（%d个选项）：%v，应为%v", strings.TrimPrefix(c.src, dir), len(c.opts), got, c.want)
+		}
+	}
+
+	//没有WithTrailingSlash时结尾的分隔符没有作用
+	if got := planNames(t, app+sep); !reflect.DeepEqual(got, contents) {
+		t.Errorf("默认：%v", got)
+	}
+	if got := planNames(t, app+sep, WithKeepBaseDir()); !reflect.DeepEqual(got, withBase) {
+		t.Errorf("默认加WithKeepBaseDir：%v", got)
+	}
+
+	//"."等无法确定顶层名称的src按原来的行为处理，"../app"可以确定
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(app); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for src, want := range map[string][]string{
+		".":                      contents,
+		"." + sep:                contents,
+		".." + sep + "app":       withBase,
+		".." + sep + "app" + sep: contents,
+	} {
+		if got := planNames(t, src, WithTrailingSlash()); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q：%v，应为%v", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package targz
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+//lseek的whence参数，定义在linux/fs.h中
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+//用SEEK_DATA/SEEK_HOLE找出文件中的数据区，只读取数据区，空洞直接写入0
+//写入w的仍然是完整的内容，只是省去了读取空洞的开销
+//文件系统不支持查找空洞时返回false，调用者应该按普通文件复制
+func copySparse(w io.Writer, f *os.File, size int64) (bool, error) {
+	var off int64
+	for off < size {
+		data, err := f.Seek(off, seekData)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				//后面没有数据了，剩下的都是空洞
+				data = size
+			} else if off == 0 {
+				//还没有写入任何数据，可以退回到普通的复制
+				return false, nil
+			} else {
+				return true, err
+			}
+		}
+		if data > size {
+			data = size
+		}
+
+		if err := writeZeros(w, data-off); err != nil {
+			return true, err
+		}
+		if data == size {
+			break
+		}
+
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return true, err
+		}
+		if hole > size {
+			hole = size
+		}
+
+		if _, err := f.Seek(data, io.SeekStart); err != nil {
+			return true, err
+		}
+		if _, err := io.CopyN(w, f, hole-data); err != nil {
+			return true, err
+		}
+		off = hole
+	}
+	return true, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package targz
+
+import (
+	"io"
+	"os"
+)
+
+//这个平台不支持查找空洞，总是按普通文件复制
+func copySparse(w io.Writer, f *os.File, size int64) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package targz
+
+import (
+	"archive/tar"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+//目录下有命名管道和套接字时打包也能完成：命名管道打包为TypeFifo，套接字跳过并产生警告
+func TestTarSpecialFiles(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a"})
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(src, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var stats Stats
+	dest := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := TarWithOptions(src, dest, WithStats(&stats)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]byte)
+	for _, e := range entries {
+		types[e.Name] = e.Typeflag
+	}
+	if types["fifo"] != tar.TypeFifo {
+		t.Fatalf("命名管道的类型是%q", types["fifo"])
+	}
+	if _, ok := types["sock"]; ok {
+		t.Fatal("打包了套接字")
+	}
+	if len(stats.Warnings) != 1 || stats.Warnings[0].Name != "sock" || stats.Warnings[0].Category != WarnUnsupported {
+		t.Fatalf("警告是%v", stats.Warnings)
+	}
+
+	dst := t.TempDir()
+	if err := UnTar(dest, dst); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(filepath.Join(dst, "fifo")); err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatal("没有还原命名管道", err)
+	}
+}
@@ -0,0 +1,161 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//将文件或者目录打包后按volumeSize字节切分为多个分卷，返回按顺序生成的所有分卷
+//destPattern中含有`%`时作为fmt的格式，例如"backup-%02d.tgz"，否则在其后加上.001、.002……
+//切分的是压缩后的字节流，分卷的边界和包中的项无关，全部按顺序拼接起来就是完整的.tar.gz，
+//可以用UnTarVolumes解压，也可以cat backup.tar.gz.* | tar -xz
+//分卷已存在时按WithOverwriteMode的方式处理；打包失败时删除已经生成的所有分卷
+func TarSplit(src string, destPattern string, volumeSize int64, opts ...Option) (parts []string, err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.compressionFor(destPattern); err != nil {
+		return nil, err
+	}
+
+	if volumeSize <= 0 {
+		return nil, errors.New("分卷的大小必须大于0")
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return nil, errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	sw := &splitWriter{pattern: destPattern, size: volumeSize, o: o}
+	defer func() {
+		if er := sw.close(); er != nil && err == nil {
+			err = er
+		}
+		if err != nil && !isPartial(err) {
+			for _, part := range sw.parts {
+				os.Remove(part)
+			}
+			parts = nil
+		}
+	}()
+
+	err = tarToWriter(context.Background(), sw, o, func(p *packer) error {
+		return p.tarSrc(src)
+	})
+	return sw.parts, err
+}
+
+//按顺序拼接parts中的分卷，解压到dstDir文件夹下，parts通常是TarSplit的返回值
+func UnTarVolumes(parts []string, dstDir string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	if len(parts) == 0 {
+		return errors.New("没有指定要解压的分卷")
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		fr, err := os.Open(part)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+		readers = append(readers, fr)
+	}
+
+	return unTarFromReader(context.Background(), io.MultiReader(readers...), dstDir, o)
+}
+
+//写满size字节后自动创建下一个分卷的io.Writer
+type splitWriter struct {
+	pattern string
+	size    int64
+	o       *options
+
+	parts []string //已经创建的分卷
+	f     *os.File //正在写入的分卷
+	n     int64    //正在写入的分卷已写入的字节数
+}
+
+func (w *splitWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		//当前分卷写满后才创建下一个，不会留下空的分卷
+		if w.f == nil || w.n == w.size {
+			if err := w.next(); err != nil {
+				return written, err
+			}
+		}
+
+		chunk := p
+		if left := w.size - w.n; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		n, err := w.f.Write(chunk)
+		written += n
+		w.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+//关闭当前的分卷，创建下一个分卷
+func (w *splitWriter) next() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	name := w.pattern
+	if strings.Contains(name, "%") {
+		name = fmt.Sprintf(name, len(w.parts)+1)
+	} else {
+		name = fmt.Sprintf("%s.%03d", name, len(w.parts)+1)
+	}
+
+	var f *os.File
+	var err error
+	if w.o.overwrite == OverwriteReplace {
+		f, err = os.Create(name)
+	} else {
+		f, err = createExclusive(name, w.o.overwrite)
+	}
+	if err != nil {
+		return err
+	}
+	w.f, w.n = f, 0
+	w.parts = append(w.parts, name)
+	return nil
+}
+
+//关闭正在写入的分卷
+func (w *splitWriter) close() error {
+	if w.f == nil {
+		return nil
+	}
+	var err error
+	if w.o.sync {
+		err = w.f.Sync()
+	}
+	if er := w.f.Close(); er != nil && err == nil {
+		err = er
+	}
+	if err == nil && w.o.sync {
+		err = syncDir(filepath.Dir(w.f.Name()))
+	}
+	w.f = nil
+	return err
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package targz
+
+import (
+	"os"
+	"path/filepath"
+)
+
+//这个平台取不到主次设备号，设备文件跳过不打包
+const devicesSupported = false
+
+//这个平台取不到inode，硬链接按普通文件完整打包
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+//这个平台取不到设备号，不支持WithOneFileSystem
+const deviceIDSupported = false
+
+func deviceID(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+//这个平台取不到inode，用解析了符号链接之后的绝对路径识别目录
+func dirKey(fi os.FileInfo, path string) (dirID, bool) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return dirID{}, false
+	}
+	abs, err := filepath.Abs(real)
+	if err != nil {
+		return dirID{}, false
+	}
+	return dirID{path: abs}, true
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package targz
+
+import (
+	"os"
+	"syscall"
+)
+
+//这个平台可以打包设备文件，FileInfoHeader会填写主次设备号
+const devicesSupported = true
+
+//获取文件的设备号和inode，用于识别硬链接
+//只有硬链接数大于1的普通文件才需要记录
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 || !fi.Mode().IsRegular() {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+//这个平台可以取得文件所在的设备号，支持WithOneFileSystem
+const deviceIDSupported = true
+
+//获取文件所在的设备号，用于发现挂载点
+func deviceID(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+//目录的设备号和inode，用于发现循环
+func dirKey(fi os.FileInfo, path string) (dirID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return dirID{}, false
+	}
+	return dirID{id: fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}}, true
+}
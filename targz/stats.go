@@ -0,0 +1,75 @@
+package targz
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+//打包的统计信息，通过WithStats或者TarWithStats获得
+//UnTar、UnZip等解压函数使用WithStats时填写Files、Dirs、Bytes、Errors、Elapsed、SkippedExisting和Warnings
+type Stats struct {
+	Files           int           //文件数，包括链接、命名管道等所有不是目录的项
+	Dirs            int           //目录数
+	Bytes           int64         //文件内容的总字节数，未压缩
+	CompressedBytes int64         //压缩后写入目标的字节数
+	Elapsed         time.Duration //耗时
+	ContentDigest   string        //未压缩的tar流的SHA-256，十六进制，和压缩格式无关，见TarContentDigest；失败时为空
+	Skipped         int           //被排除模式和过滤函数跳过的项数，跳过的目录只算一项
+
+	SkippedBySize      int   //因为WithMinSize、WithMaxSize跳过的文件数，不计入Skipped
+	SkippedBySizeBytes int64 //因为大小跳过的文件的总字节数
+	Errors             int   //ContinueOnError时出错而跳过的项数
+	DepthPruned        int   //因为WithMaxDepth只写入了目录本身、没有遍历其下内容的目录数
+	SkippedAppleDouble int   //因为WithSkipAppleDouble跳过的macOS元数据文件和目录数，同时计入Skipped
+	Deduplicated       int   //因为WithDedupe记录为硬链接的文件数，同时计入Files
+	DeduplicatedBytes  int64 //这些文件的内容节省的字节数，不计入Bytes
+	Unchanged          int   //因为WithNewerThan、WithSnapshot没有打包的未变化的文件数，不计入Skipped
+	SkippedExisting    int   //解压时因为WithExtractOverwrite保留了已存在的文件而跳过的项数，不计入Files
+
+	Warnings []Warning //不影响结果的问题，按发生的顺序排列
+}
+
+//压缩率，压缩后的字节数占文件内容字节数的比例
+func (s *Stats) Ratio() float64 {
+	if s.Bytes == 0 {
+		return 0
+	}
+	return float64(s.CompressedBytes) / float64(s.Bytes)
+}
+
+//同TarWithOptions，打包完成后返回统计信息，出错时返回的统计信息是出错前的进度
+func TarWithStats(src string, dest string, opts ...Option) (*Stats, error) {
+	stats := &Stats{}
+	err := TarWithOptions(src, dest, append(opts, WithStats(stats))...)
+	return stats, err
+}
+
+//压缩后的数据超过WithMaxArchiveSize设置的大小时返回的错误
+type ArchiveSizeError struct {
+	Limit int64  //设置的大小限制
+	Name  string //超过限制时正在写入的项，关闭时才超过限制则为最后一项；并行压缩时可能是稍后写入的项
+}
+
+func (e *ArchiveSizeError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("压缩包超过了%d字节的大小限制", e.Limit)
+	}
+	return fmt.Sprintf("写入%s时压缩包超过了%d字节的大小限制", e.Name, e.Limit)
+}
+
+//统计写入字节数的io.Writer，limit大于0时超过limit字节返回*ArchiveSizeError
+type countingWriter struct {
+	w     io.Writer
+	n     int64
+	limit int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.limit > 0 && w.n+int64(len(p)) > w.limit {
+		return 0, &ArchiveSizeError{Limit: w.limit}
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
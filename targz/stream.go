@@ -0,0 +1,71 @@
+package targz
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+//将文件或者目录打包，以io.ReadCloser的形式返回压缩包的数据，适合交给需要读取数据的接口，例如上传、http.Post
+//打包在另一个goroutine中进行，读取多快就打包多快；打包的错误在读完数据之后由Read返回，Close也会返回
+//必须调用Close：没有读完就关闭时停止打包并释放打开的文件，这时Close不返回停止打包造成的错误
+func TarStream(src string, opts ...Option) (io.ReadCloser, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+
+	if !Exists(src) {
+		return nil, errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	s := &tarStream{pr: pr, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		s.err = tarToWriter(ctx, pw, o, func(p *packer) error {
+			return p.tarSrc(src)
+		})
+		//err为nil时读取方得到io.EOF
+		pw.CloseWithError(s.err)
+	}()
+	return s, nil
+}
+
+//关闭读取端后写入端得到的错误
+var errStreamClosed = errors.New("TarStream已经关闭")
+
+//TarStream返回的读取端
+type tarStream struct {
+	pr     *io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{} //打包的goroutine结束时关闭
+	err    error         //打包的结果，done关闭之后才能读取
+	closed bool
+}
+
+func (s *tarStream) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+//停止打包并等待打包的goroutine结束，返回打包中除关闭造成的以外的错误
+func (s *tarStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	s.cancel()
+	s.pr.CloseWithError(errStreamClosed)
+	<-s.done
+
+	if errors.Is(s.err, errStreamClosed) || errors.Is(s.err, context.Canceled) {
+		return nil
+	}
+	return s.err
+}
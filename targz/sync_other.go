@@ -0,0 +1,8 @@
+//go:build !unix
+
+package targz
+
+//Windows等平台无法打开目录同步，由文件系统保证元数据的持久化
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package targz
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//WithSync时写入临时文件、直接写入和追加都会同步文件和所在的目录，结果和不同步时一样
+func TestTarSync(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "b/c.txt": "c"})
+	extra := t.TempDir()
+	writeTree(t, extra, map[string]string{"d.txt": "d"})
+	want := []string{"a.txt", "b/", "b/c.txt", "d.txt"}
+
+	for _, opts := range [][]Option{{WithSync()}, {WithSync(), WithDirectWrite()}} {
+		dest := filepath.Join(t.TempDir(), "out.tar.gz")
+		if err := TarWithOptions(src, dest, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if err := AppendWithOptions(dest, []string{filepath.Join(extra, "d.txt")}, WithSync()); err != nil {
+			t.Fatal(err)
+		}
+		if got := archiveNames(t, dest); !reflect.DeepEqual(got, want) {
+			t.Fatalf("打包的项是%v，应为%v", got, want)
+		}
+	}
+
+	if err := syncDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
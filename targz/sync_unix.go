@@ -0,0 +1,15 @@
+//go:build unix
+
+package targz
+
+import "os"
+
+//同步目录本身，使其中文件的创建和Rename在断电后也能保留
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -1,13 +1,22 @@
 package targz
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"errors"
+	"fmt"
+	"path"
 	"path/filepath"
+	"strings"
 	"compress/gzip"
 	"archive/tar"
 	"os"
+	"os/user"
+	"strconv"
+	"time"
+	"crypto/sha256"
+	"encoding/hex"
 )
 
 
@@ -16,220 +25,1872 @@ import (
 //dest是要生成.tar.gz文件的路径
 //failIfExist标识：如果dest文件存在，是否要放弃打包，如果否，则会覆盖已存在的文件
 func Tar(src string, dest string, failIfExist bool) (err error) {
+	return TarWithOptions(src, dest, WithOverwriteMode(overwriteMode(failIfExist)))
+}
+
+//将文件或者目录打成.tar.gz的文件，通过opts调整打包的行为
+//src是要打包的文件或者目录
+//dest是要生成.tar.gz文件的路径，默认dest存在时放弃打包，可以用WithOverwriteMode改为覆盖或者跳过
+//内容先写入同一目录下的临时文件，成功关闭后才Rename为dest，失败时删除临时文件，不会留下不完整的压缩包；
+//不覆盖时先用O_EXCL创建空的dest占住名称，打包过程中dest是空文件，失败时删除
+func TarWithOptions(src string, dest string, opts ...Option) (err error) {
+	return TarContext(context.Background(), src, dest, opts...)
+}
+
+//同TarWithOptions，ctx取消时停止打包并返回包装了ctx.Err()的错误
+//每打包一项之前都会检查ctx，复制大文件的过程中也会检查，所以取消后很快就会返回
+func TarContext(ctx context.Context, src string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+
+	o.srcForm(src)
 	src = filepath.Clean(src)
 
 	if !Exists(src) {
 		return errors.New("要打包的文件或者目录不存在："+src)
 	}
+	if o.checkpoint != "" {
+		return tarCheckpointed(ctx, src, dest, o, nil)
+	}
 
-	if FileExists(dest) {
-		if failIfExist { //不覆盖已存在的文件
-			return errors.New("目标文件已存在："+dest)
-		} else { //覆盖掉已存在的文件
-			if err := os.Remove(dest); err != nil {
-				return err
-			}
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		//过滤函数等用户代码发生panic时，先删除写了一半的文件再继续panic
+		if r := recover(); r != nil {
+			d.abort()
+			panic(r)
 		}
+		err = d.finish(err)
+	}()
+
+	return tarToWriter(ctx, d.f, o, func(p *packer) error {
+		return p.tarSrc(src)
+	})
+}
+
+//将多个文件或者目录打包到同一个.tar.gz文件中
+//dest是要生成.tar.gz文件的路径
+//failIfExist标识：同Tar
+//srcs是要打包的文件或者目录，每一个都以自己的名称作为包内的顶层目录或者文件，
+//例如/etc/myapp/conf打包后为conf/...，顶层名称重复时会返回错误
+func TarAll(dest string, failIfExist bool, srcs ...string) (err error) {
+	if len(srcs) == 0 {
+		return errors.New("没有指定要打包的文件或者目录")
 	}
 
-	//创建空的目标文件
-	fw, err := os.Create(dest)
+	o, err := newOptions(nil)
 	if err != nil {
 		return err
 	}
-	defer fw.Close()
 
-	gw := gzip.NewWriter(fw)
-	defer gw.Close()
+	//先检查所有的源，避免打包到一半才发现问题
+	cleaned, err := checkSrcs(srcs)
+	if err != nil {
+		return err
+	}
 
-	tw := tar.NewWriter(gw)
+	o.overwrite = overwriteMode(failIfExist)
+	if err := o.compressionFor(dest); err != nil {
+		return err
+	}
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		//判断tw是否关闭成功，如果失败，可能打包的目标文件不完整
-		if er := tw.Close(); er != nil {
-			err = er
-		}
+		err = d.finish(err)
 	}()
 
-	fi, err := os.Stat(src)
+	tw, closeTw, err := newTarGzWriter(d.f, o)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if er := closeTw(); er != nil && err == nil {
+			err = er
+		}
+	}()
 
-	if fi.IsDir() {
-		//读取目录下的所有文件
-		fis, err := ioutil.ReadDir(src)
-		if err != nil {
+	p := newPacker(context.Background(), tw, o)
+	for _, src := range cleaned {
+		if err := p.tarRooted(src); err != nil {
 			return err
 		}
+	}
 
-		last := len(src)-1
-		if src[last] != os.PathSeparator {
-			src += string(os.PathSeparator)
+	return nil
+}
+
+//检查要以各自的名称作为顶层的多个源，返回清理后的路径
+//源不存在、无法确定顶层名称或者顶层名称重复时返回错误
+func checkSrcs(srcs []string) ([]string, error) {
+	cleaned := make([]string, 0, len(srcs))
+	names := make(map[string]string, len(srcs))
+	for _, src := range srcs {
+		src = filepath.Clean(src)
+		if !Exists(src) {
+			return nil, errors.New("要打包的文件或者目录不存在："+src)
 		}
 
-		//遍历所有文件
-		for _, fi := range fis {
-			if fi.IsDir() {
-				tarDir(src, fi.Name(), tw, fi)
-			} else {
-				tarFile(src, fi.Name(), tw, fi)
+		name := filepath.Base(src)
+		if name == "." || name == ".." || name == string(os.PathSeparator) {
+			return nil, errors.New("无法确定包内的顶层名称："+src)
+		}
+		if prev, ok := names[name]; ok {
+			return nil, fmt.Errorf("包内的顶层名称重复：%s 和 %s 都是 %s", prev, src, name)
+		}
+		names[name] = src
+		cleaned = append(cleaned, src)
+	}
+	return cleaned, nil
+}
+
+//正在写入的目标文件
+//默认写入同一目录下的临时文件，全部写完并关闭后再Rename为dest，失败时dest不会出现写了一半的内容
+type destFile struct {
+	f           *os.File
+	dest        string
+	tmp         string //临时文件的路径，WithDirectWrite时为空
+	backup      string //WithDirectWrite覆盖已存在的文件时，原文件暂时改名后的路径
+	sync        bool   //WithSync时关闭前同步文件，完成后同步所在的目录
+	placeholder bool   //不覆盖已存在的文件时，先用O_EXCL创建了空的dest占住名称，失败时要删除
+}
+
+//按照o.overwrite的要求创建空的目标文件
+//不覆盖已存在的文件时用O_EXCL创建dest，检查和创建是一步完成的，同时生成同一个dest时只有一个能成功
+func createDest(dest string, o *options) (*destFile, error) {
+	d := &destFile{dest: dest, sync: o.sync}
+	if o.overwrite != OverwriteReplace {
+		f, err := createExclusive(dest, o.overwrite)
+		if err != nil {
+			return nil, err
+		}
+		if o.directWrite {
+			d.f = f
+			o.skipSelf(dest)
+			return d, nil
+		}
+		//内容仍然写入临时文件，完成后Rename覆盖占位的空文件
+		f.Close()
+		d.placeholder = true
+		o.skipSelf(dest)
+	} else if o.directWrite {
+		if FileExists(dest) { //先把已存在的文件改名保留下来，打包成功后才删除
+			backup, err := createTemp(dest, ".bak-")
+			if err != nil {
+				return nil, err
 			}
+			backup.Close()
+			if err := os.Rename(dest, backup.Name()); err != nil {
+				os.Remove(backup.Name())
+				return nil, err
+			}
+			d.backup = backup.Name()
 		}
 
-	} else {
-		//获取要打包的文件或者目录的所在位置和名称
-		srcBase, srcRelative := filepath.Split(filepath.Clean(src))
-		return tarFile(srcBase, srcRelative, tw, fi)
+		f, err := os.Create(dest)
+		if err != nil {
+			d.restore()
+			return nil, err
+		}
+		d.f = f
+		o.skipSelf(dest, d.backup)
+		return d, nil
 	}
 
-	return nil
+	f, err := createTemp(dest, ".tmp-")
+	if err != nil {
+		if d.placeholder {
+			os.Remove(dest)
+		}
+		return nil, err
+	}
+	o.skipSelf(dest, f.Name())
+	d.f, d.tmp = f, f.Name()
+	return d, nil
 }
 
-// 因为要执行遍历操作，所以要单独创建一个函数
-func tarDir(srcBase string, srcRelative string, tw *tar.Writer, fi os.FileInfo) (err error) {
-	//获取完整路径
-	srcFull := srcBase+srcRelative
+//用O_EXCL创建name，已存在时按mode返回包装了ErrExist的错误或者ErrSkipped
+func createExclusive(name string, mode OverwriteMode) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		if mode == OverwriteSkip {
+			return nil, ErrSkipped
+		}
+		return nil, fmt.Errorf("%w：%s", ErrExist, name)
+	}
+	return f, err
+}
 
-	//判断目录路径是否带`/`，如果没有，添加上
-	last := len(srcRelative) - 1
-	if srcRelative[last] != os.PathSeparator {
-		srcRelative += string(os.PathSeparator)
+//记下正在写入的文件，dest在要打包的目录下时，打包时跳过这些文件，不会把压缩包打包进自己
+func (o *options) skipSelf(names ...string) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil {
+			o.selfFiles = append(o.selfFiles, fi)
+		}
 	}
+}
 
-	//读取目录下的所有文件
-	fis, err := ioutil.ReadDir(srcFull)
-	if err != nil {
-		return err
+//判断是否是正在写入的压缩包或者它的临时文件
+func (p *packer) isSelf(fi os.FileInfo) bool {
+	for _, self := range p.opts.selfFiles {
+		if os.SameFile(self, fi) {
+			return true
+		}
 	}
+	return false
+}
 
-	//遍历所有文件
-	for _, fi := range fis {
-		if fi.IsDir() {
-			tarDir(srcBase, srcRelative+fi.Name(), tw, fi)
-		} else {
-			tarFile(srcBase, srcRelative+fi.Name(), tw, fi)
+//在dest所在的目录下创建名为dest<suffix><随机数>的文件
+//不使用ioutil.TempFile，是为了和os.Create一样按0666和umask设置权限
+func createTemp(dest string, suffix string) (*os.File, error) {
+	seed := uint32(time.Now().UnixNano() + int64(os.Getpid()))
+	for i := 0; i < 10000; i++ {
+		//线性同余，和ioutil.TempFile的做法一样
+		seed = seed*1664525 + 1013904223
+		name := dest + suffix + strconv.Itoa(int(1e9+seed%1e9))[1:]
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
 		}
+		return f, err
 	}
+	return nil, errors.New("无法创建临时文件："+dest)
+}
 
-	if len(srcRelative) > 0 {
-		hdr, err := tar.FileInfoHeader(fi, "")
-		if err != nil {
+//err为nil时关闭文件并把临时文件Rename为dest，否则删除写了一半的文件，返回最终的错误
+//ContinueOnError时部分项出错，压缩包仍然是完整的，照常保存后返回原来的错误
+func (d *destFile) finish(err error) error {
+	if err != nil && !isPartial(err) {
+		d.abort()
+		return err
+	}
+
+	if d.sync {
+		if err := d.f.Sync(); err != nil {
+			d.abort()
 			return err
 		}
+	}
+	if err := d.f.Close(); err != nil {
+		d.abort()
+		return err
+	}
+	if d.tmp == "" {
+		if d.backup != "" {
+			os.Remove(d.backup)
+		}
+		return d.syncDir(err)
+	}
+	if err := os.Rename(d.tmp, d.dest); err != nil {
+		os.Remove(d.tmp)
+		return err
+	}
+	return d.syncDir(err)
+}
 
-		hdr.Name = filepath.ToSlash(srcRelative)
+//WithSync时同步dest所在的目录，使文件的创建和Rename也写入磁盘，同步失败的错误优先于err
+func (d *destFile) syncDir(err error) error {
+	if !d.sync {
+		return err
+	}
+	if er := syncDir(filepath.Dir(d.dest)); er != nil {
+		return er
+	}
+	return err
+}
 
-		if err =tw.WriteHeader(hdr); err != nil {
-			return err
+//关闭并删除写了一半的文件，原来的目标文件保持不变
+func (d *destFile) abort() {
+	d.f.Close()
+	if d.tmp != "" {
+		os.Remove(d.tmp)
+		if d.placeholder {
+			os.Remove(d.dest)
 		}
+	} else {
+		os.Remove(d.dest)
+		d.restore()
 	}
-	return nil
 }
 
-// 因为要在 defer 中关闭文件，所以要单独创建一个函数
-func tarFile(srcBase string, srcRelative string, tw *tar.Writer, fi os.FileInfo) (err error) {
-	//获取完整路径
-	srcFull := srcBase+srcRelative
+//把改名保留的原文件恢复为dest
+func (d *destFile) restore() {
+	if d.backup != "" {
+		os.Rename(d.backup, d.dest)
+	}
+}
 
-	hdr, err := tar.FileInfoHeader(fi, "")
+//在w上依次套上压缩和tar，压缩格式和级别由o决定
+//返回的函数按顺序关闭tar和gzip，并返回遇到的第一个错误
+func newTarGzWriter(w io.Writer, o *options) (*tar.Writer, func() error, error) {
+	gw, err := newCompressStream(w, o)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	tw := tar.NewWriter(gw)
+	return tw, closeTarGz(tw, gw), nil
+}
+
+//在w上创建压缩，有WithTee时同时写入ws
+func newCompressStream(w io.Writer, o *options) (io.WriteCloser, error) {
+	if len(o.tees) > 0 {
+		w = &teeWriter{w: w, tees: o.tees}
 	}
-	hdr.Name = filepath.ToSlash(srcRelative)
+	gw, err := newCompressWriter(w, o)
+	if err != nil || o.digest == nil {
+		return gw, err
+	}
+	return &digestWriter{WriteCloser: gw, h: o.digest}, nil
+}
 
-	if err := tw.WriteHeader(hdr); err != nil {
+//按顺序关闭tw和gw
+func closeTarGz(tw *tar.Writer, gw io.Closer) func() error {
+	return func() error {
+		//必须先关闭tw再关闭gw，否则tar的结束块不会被压缩写出
+		err := tw.Close()
+		if er := gw.Close(); er != nil && err == nil {
+			err = er
+		}
 		return err
 	}
+}
 
-	// 打开要打包的文件，准备读取
-	fr, err := os.Open(srcFull)
+//将文件或者目录打成.tar.gz的数据流，写入到w中
+//src是要打包的文件或者目录
+//w是接收数据的目标，可以是文件、网络连接、管道等，由调用者负责关闭
+//因为没有文件可以事后检查，tar和gzip在关闭时的错误都会返回给调用者
+func TarToWriter(src string, w io.Writer, opts ...Option) (err error) {
+	o, err := newOptions(opts)
 	if err != nil {
 		return err
 	}
-	defer fr.Close()
 
-	if _, err := io.Copy(tw, fr); err != nil {
+	o.srcForm(src)
+	src = filepath.Clean(src)
+
+	if !Exists(src) {
+		return errors.New("要打包的文件或者目录不存在："+src)
+	}
+
+	return tarToWriter(context.Background(), w, o, func(p *packer) error {
+		return p.tarSrc(src)
+	})
+}
+
+//在w上创建tar和gzip，由walk把要打包的内容写入packer，最后按顺序关闭并填写统计信息
+func tarToWriter(ctx context.Context, w io.Writer, o *options, walk func(p *packer) error) (err error) {
+	var expectedBytes int64
+	var expectedEntries int
+	if o.prescan && o.progress != nil {
+		expectedBytes, expectedEntries, err = prescan(ctx, o, walk)
+		if err != nil {
+			return err
+		}
+	}
+
+	t, err := newTarOutput(ctx, w, o)
+	if err != nil {
 		return err
 	}
+	t.p.progress.info.ExpectedBytes = expectedBytes
+	t.p.progress.info.ExpectedEntries = expectedEntries
+	defer func() {
+		err = t.close(err)
+	}()
 
+	err = walk(t.p)
+	if err == nil {
+		err = t.p.tarExtras()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("打包被取消：%w", ctx.Err())
+		}
+		return err
+	}
 	return nil
 }
 
-//将.tar.gz的文件解压到dstDir文件夹下
-//srcTar是要解压的.tar.gz文件
-//dstDir是要解压到的目标文件夹
-func UnTar(srcTar string, dstDir string) (err error) {
-	srcTar = filepath.FromSlash(srcTar)
-	//清理路径字符串
-	dstDir = filepath.Clean(dstDir) + string(os.PathSeparator)
+//正在写入的压缩包，由tarToWriter和Writer共用
+type tarOutput struct {
+	p       *packer
+	cw      *countingWriter
+	closeTw func() error
+	start   time.Time
 
-	if !Exists(srcTar) {
-		return errors.New("要解压的文件不存在："+srcTar)
+	verifyFile   *os.File //WithVerify时重新读取的文件
+	verifyOffset int64    //压缩包在verifyFile中的起始位置
+}
+
+//在w上创建tar和压缩
+func newTarOutput(ctx context.Context, w io.Writer, o *options) (*tarOutput, error) {
+	start := time.Now()
+
+	t := &tarOutput{start: start}
+	if o.checkpoint != "" && o.checkpointer == nil {
+		return nil, errors.New("WithCheckpoint只能用于Tar、TarWithOptions和TarContext")
+	}
+	snap, err := loadSnapshot(o)
+	if err != nil {
+		return nil, err
+	}
+	if o.verify {
+		f, offset, err := newVerifyTarget(w)
+		if err != nil {
+			return nil, err
+		}
+		t.verifyFile, t.verifyOffset = f, offset
 	}
 
-	//打开要解压的文件
-	fr, err := os.Open(srcTar)
+	//Stats.ContentDigest在压缩之前计算，断点续传时从断点记录的状态继续
+	if o.stats != nil || o.checkpointer != nil {
+		o.digest = sha256.New()
+	}
+
+	//统计压缩后的字节数，同时检查大小限制
+	cw := &countingWriter{w: w, limit: o.maxArchiveSize}
+	var tw *tar.Writer
+	var closeTw func() error
+	var ratio *ratioTracker
+	if o.checkpointer != nil {
+		tw, closeTw, err = o.checkpointer.newTarWriter(cw)
+	} else if o.entryRatio != nil {
+		tw, closeTw, ratio, err = newRatioTarWriter(cw, o)
+	} else {
+		tw, closeTw, err = newTarGzWriter(cw, o)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer fr.Close()
 
-	gr, err := gzip.NewReader(fr)
+	logStart(o, "开始打包")
+	t.p, t.cw, t.closeTw = newPacker(ctx, tw, o), cw, closeTw
+	t.p.ratio, t.p.snap, t.p.checkpoint = ratio, snap, o.checkpointer
+	return t, nil
+}
+
+//按顺序关闭tar和压缩，写入清单并填写统计信息，返回最终的错误
+func (t *tarOutput) close(err error) error {
+	p, o := t.p, t.p.opts
+	if err == nil && p.ratio != nil {
+		//报告最后一项
+		err = p.ratio.next(nil)
+	}
+	if er := t.closeTw(); er != nil && err == nil {
+		err = er
+	}
+	p.nameSizeError(err)
+	if err == nil && t.verifyFile != nil {
+		err = verifyArchive(io.NewSectionReader(t.verifyFile, t.verifyOffset, t.cw.n), o, p.written)
+	}
+	if err == nil && o.manifest != nil {
+		err = p.writeManifest()
+	}
+	if err == nil {
+		err = multiError(p.errs)
+	}
+	if err == nil {
+		err = p.saveSnapshot()
+	}
+	p.logFinish(err, t.cw.n, time.Since(t.start))
+	if o.stats != nil {
+		*o.stats = p.stats
+		o.stats.CompressedBytes = t.cw.n
+		o.stats.Elapsed = time.Since(t.start)
+		if o.digest != nil && (err == nil || isPartial(err)) {
+			o.stats.ContentDigest = hex.EncodeToString(o.digest.Sum(nil))
+		}
+	}
+	return err
+}
+
+//压缩包超过大小限制时，在错误中记下正在写入的项
+//写出可能在并行压缩的goroutine中发生，所以在这里而不是在countingWriter中填写
+func (p *packer) nameSizeError(err error) {
+	var se *ArchiveSizeError
+	if errors.As(err, &se) && se.Name == "" {
+		se.Name = p.current
+	}
+}
+
+//GNU tar和bsdtar在PAX记录中保存扩展属性时使用的前缀
+const paxXattrPrefix = "SCHILY.xattr."
+
+var errXattrUnsupported = errors.New("这个平台不支持扩展属性")
+
+//根目录在包内的名称，与GNU tar打包`.`时一致
+const rootEntryName = "./"
+
+//打包过程中的状态，在tarDir和tarFile之间传递
+type packer struct {
+	ctx       context.Context
+	tw        *tar.Writer
+	opts      *options
+	links     map[fileID]string //已经打包过的硬链接文件，值为第一次出现时的包内名称
+	ancestors []os.FileInfo     //正在遍历的各层目录，用于发现符号链接造成的循环
+	visiting  map[dirID]bool    //正在遍历的各层目录的标识，用于发现符号链接、绑定挂载造成的循环
+	srcRoot   string            //源本身是文件或者保留了顶层目录时，源在包内的相对路径，不受WithSkipHidden影响
+	ignores   []ignoreRules     //正在遍历的各层目录中忽略文件的规则
+	rootDev   uint64            //源所在的设备号，WithOneFileSystem时跳过其他设备上的目录
+	limiter   *rateLimiter      //WithRateLimit时所有文件共用的限速
+	broken    bool              //写入压缩包失败，不能再继续
+	errs      []*EntryError     //ContinueOnError时出错的项
+
+	unames map[int]string //uid对应的用户名
+	gnames map[int]string //gid对应的组名
+
+	progress progress
+
+	stats Stats
+
+	dryRun  bool    //只记录会写入的项，不写入也不读取文件内容，见Plan
+	entries []Entry //dryRun时记录的项
+
+	names   map[string]bool //已经写入的包内名称，用于发现和额外的项同名
+	unique  bool            //包内的名称不能重复，同名的目录除外，见Writer
+
+	normalizer *normalizer             //WithNormalizeNames时规范化包内的名称
+	ratio      *ratioTracker           //WithEntryRatio时统计每一项的压缩效果
+	dupes      map[int64][]*dedupeFile //WithDedupe时已经打包的文件，键为大小
+	snap       *snapshot               //WithSnapshot时增量打包的状态
+	shard      *shardFilter            //TarSharded时只打包属于当前压缩包的项
+	prefetch   *dirPrefetcher          //WithWalkConcurrency时在后台预读子目录
+	checkpoint *checkpointer           //WithCheckpoint时记录断点，Plan等只遍历的packer中为nil
+	current string          //正在写入的项
+
+	manifest []ManifestEntry //WithManifest时记录的普通文件
+	written  []verifyEntry   //WithVerify时记录写入的每一项
+}
+
+func newPacker(ctx context.Context, tw *tar.Writer, o *options) *packer {
+	p := &packer{
+		ctx:      ctx,
+		tw:       tw,
+		opts:     o,
+		progress: progress{fn: o.progress},
+		links: make(map[fileID]string),
+
+		unames: make(map[int]string),
+		gnames: make(map[int]string),
+		names:  make(map[string]bool),
+		visiting: make(map[dirID]bool),
+
+		normalizer: newNormalizer(o.nameForm),
+
+		limiter: newRateLimiter(ctx, o.rateLimit),
+	}
+
+	if o.xattrs && !xattrSupported {
+		p.warn("", WarnXattr, errXattrUnsupported)
+	}
+	return p
+}
+
+//文件在文件系统中的唯一标识
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+//目录的唯一标识，有inode的平台使用id，其他平台使用解析了符号链接之后的绝对路径
+type dirID struct {
+	id   fileID
+	path string
+}
+
+//遍历目录的最大层数，防止没有发现的循环造成无限递归
+const maxWalkDepth = 1024
+
+//以src自己的名称作为包内的顶层目录或者文件打包
+func (p *packer) tarRooted(src string) error {
+	defer p.startPrefetch()()
+	fi, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
-	defer gr.Close()
 
-	tr := tar.NewReader(gr)
+	srcBase, srcRelative := filepath.Split(src)
+	p.srcRoot = srcRelative
+	p.rootDev, _ = deviceID(fi)
+	if fi.IsDir() {
+		return p.tarDir(srcBase, srcRelative, fi)
+	}
+	return p.tarFile(srcBase, srcRelative, fi)
+}
 
-	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+//src是目录时打包其下的所有内容，是文件时打包文件本身
+func (p *packer) tarSrc(src string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	p.srcRoot = ""
+	p.rootDev, _ = deviceID(fi)
+	defer p.startPrefetch()()
+
+	if fi.IsDir() && p.opts.keepBaseDir {
+		//和GNU tar一样以源目录的名称作为顶层目录，目录本身由tarDir写入
+		abs, err := filepath.Abs(src)
 		if err != nil {
 			return err
 		}
+		srcBase, srcRelative := filepath.Split(abs)
+		if srcRelative == "" {
+			return errors.New("无法确定包内的顶层目录名称："+src)
+		}
+		p.srcRoot = srcRelative
+		return p.tarDir(srcBase, srcRelative, fi)
+	}
 
-		//获取文件信息
-		fi := hdr.FileInfo()
-
-		//获取绝对路径
-		dstDirFull := dstDir + hdr.Name
-
-		if fi.IsDir() {
-			//创建目录
-			err = os.MkdirAll(dstDirFull, fi.Mode().Perm())
+	if fi.IsDir() {
+		//先写入根目录本身，解压时才能还原它的权限和时间
+		if p.opts.rootEntry && !p.checkpoint.resuming() {
+			hdr, err := p.header(fi, rootEntryName, "")
 			if err != nil {
 				return err
 			}
-			os.Chmod(dstDirFull, fi.Mode().Perm())
-		} else {
-			// 创建文件所在的目录
-			err = os.MkdirAll(filepath.Dir(dstDirFull), os.ModePerm)
-			if err != nil {
+			p.addXattrs(hdr, src)
+			if err := p.writeHeader(hdr); err != nil {
 				return err
 			}
-			//将tr中的数据写入到文件中
-			if err := unTarFile(dstDirFull, tr); err != nil {
-				return err
+		}
+
+		//读取目录下的所有文件，ReadDir返回的结果按名称排序，保证了打包的顺序是确定的
+		fis, err := p.prefetch.read(src)
+		if err != nil {
+			return err
+		}
+		defer p.visit(src, fi)()
+		defer p.pushIgnores("", func(name string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join(src, name))
+		})()
+
+		last := len(src)-1
+		if src[last] != os.PathSeparator {
+			src += string(os.PathSeparator)
+		}
+
+		p.ancestors = append(p.ancestors, fi)
+		defer func() { p.ancestors = p.ancestors[:len(p.ancestors)-1] }()
+
+		//遍历所有文件
+		next := 0
+		for i, fi := range fis {
+			next = p.prefetch.ahead(src, fis, next, i)
+			err := p.tarEntry(src, fi.Name(), fi)
+			p.prefetch.drop(src, fi.Name())
+			if err != nil {
+				if err := p.entryFailed(filepath.ToSlash(fi.Name()), err); err != nil {
+					return err
+				}
 			}
-			os.Chmod(dstDirFull, fi.Mode().Perm())
 		}
+
+	} else {
+		//获取要打包的文件或者目录的所在位置和名称
+		srcBase, srcRelative := filepath.Split(src)
+		p.srcRoot = srcRelative
+		return p.tarFile(srcBase, srcRelative, fi)
 	}
 
 	return nil
 }
 
-// 因为要在 defer 中关闭文件，所以要单独创建一个函数
-func unTarFile(dstFile string, tr *tar.Reader) (err error) {
-	// 创建空文件，准备写入解包后的数据
-	fw, err := os.Create(filepath.FromSlash(dstFile))
-	if err != nil {
+//按类型打包目录下的一项
+func (p *packer) tarEntry(srcBase string, srcRelative string, fi os.FileInfo) error {
+	if err := p.ctx.Err(); err != nil {
 		return err
 	}
-	defer fw.Close()
 
-	if _, err := io.Copy(fw, tr); err != nil {
-		return err
+	if fi.Mode()&os.ModeSymlink != 0 && p.opts.dereference {
+		//打包链接指向的文件或者目录
+		target, err := os.Stat(srcBase + srcRelative)
+		if err != nil {
+			return fmt.Errorf("符号链接已失效：%w", err)
+		}
+
+		//指向正在遍历的某一层目录时会无限循环，跳过并记录警告
+		if target.IsDir() && p.isAncestor(target) {
+			p.warn(filepath.ToSlash(srcRelative), WarnLoop, errors.New("符号链接指向了上层目录，已跳过"))
+			return nil
+		}
+		fi = target
 	}
-	return nil
+
+	if fi.IsDir() {
+		return p.tarDir(srcBase, srcRelative, fi)
+	}
+	return p.tarFile(srcBase, srcRelative, fi)
+}
+
+//记下正在遍历的目录，返回离开目录时调用的函数；目录已经是正在遍历的某一层时返回nil
+func (p *packer) visit(path string, fi os.FileInfo) func() {
+	key, ok := dirKey(fi, path)
+	if !ok {
+		return func() {}
+	}
+	if p.visiting[key] {
+		return nil
+	}
+	p.visiting[key] = true
+	return func() { delete(p.visiting, key) }
+}
+
+//判断目录是否是正在遍历的某一层目录
+func (p *packer) isAncestor(fi os.FileInfo) bool {
+	for _, dir := range p.ancestors {
+		if os.SameFile(dir, fi) {
+			return true
+		}
+	}
+	return false
+}
+
+//判断包内的相对路径是否需要跳过，依次检查大小限制、排除模式、过滤函数、隐藏文件、忽略文件和增量打包
+func (p *packer) skip(srcRelative string, fi os.FileInfo) bool {
+	//大小限制只作用于普通文件，目录仍然会继续遍历
+	if fi.Mode().IsRegular() && !p.opts.sizeAllowed(fi.Size()) {
+		p.stats.SkippedBySize++
+		p.stats.SkippedBySizeBytes += fi.Size()
+		logSkip(p.opts, srcRelative, "size")
+		return true
+	}
+
+	var reason string
+	switch {
+	case p.excluded(srcRelative, fi):
+		reason = "exclude"
+	case p.appleDouble(srcRelative, fi):
+		reason = "appledouble"
+		p.stats.SkippedAppleDouble++
+	case p.hidden(srcRelative, fi):
+		reason = "hidden"
+	case p.ignored(srcRelative, fi):
+		reason = "ignore"
+	default:
+		//没有被排除的项才记入快照，所以增量的判断放在最后
+		if p.unchanged(srcRelative, fi) {
+			p.stats.Unchanged++
+			logSkip(p.opts, srcRelative, "unchanged")
+			return true
+		}
+		//TarSharded时不属于这个压缩包的项不算跳过
+		return p.shard != nil && !p.shard.keep(srcRelative, fi)
+	}
+	p.stats.Skipped++
+	logSkip(p.opts, srcRelative, reason)
+	return true
+}
+
+func (p *packer) excluded(srcRelative string, fi os.FileInfo) bool {
+	name := filepath.ToSlash(srcRelative)
+	if matchAny(p.opts.excludes, name) {
+		return true
+	}
+
+	if p.opts.filter != nil {
+		//传给过滤函数的路径和写入hdr.Name的一致，目录以`/`结尾
+		if fi.IsDir() && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		return !p.opts.filter(name, fi)
+	}
+	return false
+}
+
+//设置了WithMaxDepth时，判断是否不再遍历目录下的内容，源的直接子项的深度为0
+func (p *packer) tooDeep(srcRelative string) bool {
+	if p.opts.maxDepth < 0 {
+		return false
+	}
+	rel := strings.TrimSuffix(filepath.ToSlash(srcRelative), "/")
+	if p.srcRoot != "" {
+		if rel == p.srcRoot {
+			//源目录本身
+			return false
+		}
+		rel = strings.TrimPrefix(rel, p.srcRoot+"/")
+	}
+	return strings.Count(rel, "/") >= p.opts.maxDepth
+}
+
+//设置了WithSkipHidden时，判断是否是隐藏的文件或者目录，源本身总是会打包
+func (p *packer) hidden(srcRelative string, fi os.FileInfo) bool {
+	if !p.opts.skipHidden || srcRelative == p.srcRoot {
+		return false
+	}
+	return strings.HasPrefix(filepath.Base(srcRelative), ".") || hiddenAttr(fi)
+}
+
+//判断是否是macOS生成的元数据：.DS_Store、.AppleDouble目录和以`._`开头的资源分支文件
+func (p *packer) appleDouble(srcRelative string, fi os.FileInfo) bool {
+	if !p.opts.skipAppleDouble || srcRelative == p.srcRoot {
+		return false
+	}
+	name := filepath.Base(srcRelative)
+	return name == ".DS_Store" || strings.HasPrefix(name, "._") || fi.IsDir() && name == ".AppleDouble"
+}
+
+// 因为要执行遍历操作，所以要单独创建一个函数
+func (p *packer) tarDir(srcBase string, srcRelative string, fi os.FileInfo) (err error) {
+	//被排除的目录直接跳过，不再遍历其下的内容
+	if p.skip(srcRelative, fi) {
+		return nil
+	}
+	//从断点续传时，断点之前的目录本身已经写入，仍然要遍历其下的内容，和断点记录的比较
+	pos, err := p.resumePos(srcRelative, fi)
+	if err != nil {
+		return err
+	}
+	written := pos == resumeBefore
+	if p.opts.oneFileSystem {
+		if dev, ok := deviceID(fi); ok && dev != p.rootDev {
+			p.warn(filepath.ToSlash(srcRelative), WarnMountPoint, errors.New("是其他文件系统的挂载点，已跳过"))
+			logSkip(p.opts, srcRelative, "mount")
+			return nil
+		}
+	}
+
+	//获取完整路径
+	srcFull := srcBase+srcRelative
+
+	//判断目录路径是否带`/`，如果没有，添加上
+	last := len(srcRelative) - 1
+	if srcRelative[last] != os.PathSeparator {
+		srcRelative += string(os.PathSeparator)
+	}
+
+	//超过WithMaxDepth的目录只写入目录本身
+	if p.tooDeep(srcRelative) {
+		p.stats.DepthPruned++
+		logSkip(p.opts, srcRelative, "depth")
+		if written {
+			return nil
+		}
+		hdr, err := p.header(fi, srcRelative, "")
+		if err != nil {
+			return err
+		}
+		p.addXattrs(hdr, srcFull)
+		return p.writeHeader(hdr)
+	}
+
+	//目录是正在遍历的某一层目录时会无限循环，跳过并记录警告
+	leave := p.visit(srcFull, fi)
+	if leave == nil {
+		p.warn(filepath.ToSlash(srcRelative), WarnLoop, errors.New("这个目录是上层目录（符号链接或者绑定挂载造成的循环），已跳过"))
+		return nil
+	}
+	defer leave()
+	if len(p.ancestors) >= maxWalkDepth {
+		return fmt.Errorf("目录超过了%d层，可能存在循环：%s", maxWalkDepth, srcFull)
+	}
+
+	//读取目录下的所有文件，结果按名称排序
+	fis, err := p.prefetch.read(srcFull)
+	if err != nil {
+		if p.vanished(srcRelative, err) {
+			return nil
+		}
+		return err
+	}
+	defer p.pushIgnores(srcRelative, func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(srcFull, name))
+	})()
+
+	p.ancestors = append(p.ancestors, fi)
+	defer func() { p.ancestors = p.ancestors[:len(p.ancestors)-1] }()
+
+	//遍历所有文件
+	next := 0
+	for i, fi := range fis {
+		next = p.prefetch.ahead(srcFull, fis, next, i)
+		err := p.tarEntry(srcBase, srcRelative+fi.Name(), fi)
+		p.prefetch.drop(srcFull, fi.Name())
+		if err != nil {
+			if err := p.entryFailed(filepath.ToSlash(srcRelative+fi.Name()), err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(srcRelative) > 0 && !written {
+		hdr, err := p.header(fi, srcRelative, "")
+		if err != nil {
+			return err
+		}
+		p.addXattrs(hdr, srcFull)
+
+		if err = p.writeHeader(hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//根据文件信息生成tar头，name是包内的相对路径，link是符号链接的目标
+func (p *packer) header(fi os.FileInfo, name string, link string) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name, err = p.rename(filepath.ToSlash(name), fi.IsDir())
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.sourceEncoding != nil {
+		p.decodeName(hdr)
+	}
+	if p.normalizer != nil {
+		if err := p.normalizer.normalize(hdr); err != nil {
+			return nil, err
+		}
+	}
+	hdr.Format = p.opts.format
+	if p.opts.extendedTimes {
+		if hdr.Format == tar.FormatUnknown {
+			//不指定格式时archive/tar不会写入访问时间和状态改变时间
+			hdr.Format = tar.FormatPAX
+		}
+		p.addTimes(hdr, fi)
+	}
+	if p.opts.winAttrs {
+		addWinAttrs(hdr, fi)
+	}
+	if hdr.Format == tar.FormatUSTAR {
+		//USTAR只能记录精确到秒的修改时间
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	}
+
+	if p.opts.deterministic {
+		hdr.ModTime = p.opts.fixedTime
+		hdr.AccessTime = p.opts.fixedTime
+		hdr.ChangeTime = p.opts.fixedTime
+		delete(hdr.PAXRecords, birthTimePAXKey)
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+	}
+
+	if o := p.opts.owner; o != nil {
+		if o.setIDs {
+			hdr.Uid, hdr.Gid = o.uid, o.gid
+			hdr.Uname, hdr.Gname = "", ""
+		}
+		if o.setNames {
+			hdr.Uname, hdr.Gname = o.uname, o.gname
+		}
+	} else if !p.opts.deterministic {
+		p.lookupOwnerNames(hdr)
+	}
+
+	if p.opts.noExtraTimes {
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	}
+	p.adjustMode(hdr)
+	return hdr, nil
+}
+
+//按WithModeOverride、WithModeMask和WithSanitizePermissions调整tar头中的权限位，setuid等特殊位只由WithStripSpecialBits清除，符号链接不做调整
+func (p *packer) adjustMode(hdr *tar.Header) {
+	if hdr.Typeflag == tar.TypeSymlink {
+		return
+	}
+	perm := hdr.Mode & 0777
+	if m := p.opts.modeOverride; m != nil {
+		if hdr.Typeflag == tar.TypeDir {
+			perm = int64(m.dir)
+		} else {
+			perm = int64(m.file)
+		}
+	}
+	perm &^= int64(p.opts.modeMask)
+	if s := p.opts.sanitize; s != nil {
+		if hdr.Typeflag == tar.TypeDir || perm&0111 != 0 {
+			perm &= int64(s.dir)
+		} else {
+			perm &= int64(s.file)
+		}
+	}
+	hdr.Mode = hdr.Mode&^0777 | perm
+	if p.opts.stripSpecialBits {
+		hdr.Mode &^= specialModeBits
+	}
+}
+
+//tar头中setuid、setgid和sticky位，tar.FileInfoHeader根据os.ModeSetuid等设置
+const specialModeBits = 04000 | 02000 | 01000
+
+//按WithStripPrefix和WithAddPrefix改写包内的名称，先去掉前缀再加上前缀
+//目录去掉前缀后为空时成为根目录，加上前缀时成为前缀本身；结果不能是绝对路径，也不能包含`..`
+func (p *packer) rename(name string, isDir bool) (string, error) {
+	strip, add := p.opts.stripPrefix, p.opts.addPrefix
+	if strip == "" && add == "" {
+		return name, nil
+	}
+
+	rel := strings.TrimSuffix(name, "/")
+	if rel == "." {
+		rel = ""
+	}
+	if strip != "" {
+		if rel == strip {
+			rel = ""
+		} else if strings.HasPrefix(rel, strip+"/") {
+			rel = rel[len(strip)+1:]
+		}
+	}
+	if add != "" {
+		rel = path.Join(add, rel)
+	}
+
+	if rel == "" {
+		if !isDir {
+			return "", fmt.Errorf("%s 去掉前缀后名称为空", name)
+		}
+		return rootEntryName, nil
+	}
+	if !validPrefix(rel) {
+		return "", fmt.Errorf("%s 改写后的名称不合法：%s", name, rel)
+	}
+	if isDir {
+		rel += "/"
+	}
+	return rel, nil
+}
+
+//记录一个不影响打包结果的问题
+func (p *packer) warn(name string, category WarningCategory, err error) {
+	p.stats.Warnings = append(p.stats.Warnings, Warning{Name: name, Category: category, Err: err})
+	logWarning(p.opts, name, category, err)
+}
+
+//按SCHILY.xattr.的约定把文件的扩展属性保存到PAX记录中，读取失败时只记录警告
+func (p *packer) addXattrs(hdr *tar.Header, srcFull string) {
+	if !p.opts.xattrs || !xattrSupported {
+		return
+	}
+
+	xattrs, err := listXattrs(srcFull)
+	if err != nil {
+		p.warn(hdr.Name, WarnXattr, err)
+		return
+	}
+	for name, value := range xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords[paxXattrPrefix+name] = value
+	}
+}
+
+//写入tar头，指定了格式时先检查能否表示，无法表示时返回说明原因的错误，包中不会留下写了一半的项
+func (p *packer) writeHeader(hdr *tar.Header) error {
+	if p.opts.format != tar.FormatUnknown {
+		if err := tar.NewWriter(ioutil.Discard).WriteHeader(hdr); err != nil {
+			return fmt.Errorf("%s 无法用%v格式表示：%w", hdr.Name, p.opts.format, err)
+		}
+	}
+	if p.unique {
+		if name := strings.TrimSuffix(hdr.Name, "/"); p.names[name] || (p.names[name+"/"] && hdr.Typeflag != tar.TypeDir) {
+			return fmt.Errorf("包内已经有同名的项：%s", hdr.Name)
+		}
+	}
+	//改写名称后可能有多个目录对应同一个名称，例如去掉前缀后的目录和根目录，只写入第一个
+	if hdr.Typeflag == tar.TypeDir && p.names[hdr.Name] {
+		return nil
+	}
+	p.names[hdr.Name] = true
+	p.current = hdr.Name
+	if p.dryRun {
+		p.entries = append(p.entries, newEntry(hdr))
+		return nil
+	}
+
+	if p.ratio != nil {
+		if err := p.ratio.next(hdr); err != nil {
+			p.broken = true
+			return err
+		}
+	}
+	if err := p.tw.WriteHeader(hdr); err != nil {
+		p.broken = true
+		return err
+	}
+	if p.opts.verify {
+		p.written = append(p.written, verifyEntry{name: hdr.Name, size: hdr.Size})
+	}
+
+	if hdr.Typeflag == tar.TypeDir {
+		p.stats.Dirs++
+	} else {
+		p.stats.Files++
+		if hdr.Typeflag == tar.TypeReg {
+			p.stats.Bytes += hdr.Size
+		}
+	}
+	if p.opts.entryCallback != nil {
+		p.opts.entryCallback(hdr.Name, hdr)
+	}
+	p.progress.start(hdr)
+	return nil
+}
+
+//FileInfoHeader没有填写用户名和组名时，根据id查找，结果缓存在packer中
+func (p *packer) lookupOwnerNames(hdr *tar.Header) {
+	if hdr.Uname == "" {
+		name, ok := p.unames[hdr.Uid]
+		if !ok {
+			if u, err := user.LookupId(strconv.Itoa(hdr.Uid)); err == nil {
+				name = u.Username
+			}
+			p.unames[hdr.Uid] = name
+		}
+		hdr.Uname = name
+	}
+
+	if hdr.Gname == "" {
+		name, ok := p.gnames[hdr.Gid]
+		if !ok {
+			if g, err := user.LookupGroupId(strconv.Itoa(hdr.Gid)); err == nil {
+				name = g.Name
+			}
+			p.gnames[hdr.Gid] = name
+		}
+		hdr.Gname = name
+	}
+}
+
+// 因为要在 defer 中关闭文件，所以要单独创建一个函数
+func (p *packer) tarFile(srcBase string, srcRelative string, fi os.FileInfo) (err error) {
+	if p.skip(srcRelative, fi) {
+		return nil
+	}
+
+	if fi.Mode().IsRegular() && p.isSelf(fi) {
+		p.warn(filepath.ToSlash(srcRelative), WarnSelfArchive, errors.New("是正在写入的压缩包，已跳过"))
+		return nil
+	}
+	//从断点续传时，断点之前的文件已经在压缩包中
+	if pos, err := p.resumePos(srcRelative, fi); pos == resumeBefore || err != nil {
+		return err
+	}
+
+	//获取完整路径
+	srcFull := srcBase+srcRelative
+
+	//只有普通文件才需要打开读取内容，其他类型的文件打开时可能会阻塞或者出错
+	switch mode := fi.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		return p.tarSymlink(srcBase, srcRelative, fi)
+	case mode&os.ModeNamedPipe != 0:
+		return p.tarNode(srcFull, srcRelative, fi)
+	case mode&os.ModeDevice != 0:
+		if !devicesSupported {
+			p.warn(filepath.ToSlash(srcRelative), WarnUnsupported, errors.New("这个平台无法打包设备文件，已跳过"))
+			return nil
+		}
+		return p.tarNode(srcFull, srcRelative, fi)
+	case mode&os.ModeSocket != 0:
+		//tar无法表示套接字
+		p.warn(filepath.ToSlash(srcRelative), WarnUnsupported, errors.New("套接字无法打包，已跳过"))
+		return nil
+	case !mode.IsRegular():
+		p.warn(filepath.ToSlash(srcRelative), WarnUnsupported, fmt.Errorf("不支持打包%v类型的文件，已跳过", mode.Type()))
+		return nil
+	}
+
+	hdr, err := p.header(fi, srcRelative, "")
+	if err != nil {
+		return err
+	}
+
+	//同一个文件的其他硬链接只记录为指向第一次出现的TypeLink，不再重复打包内容
+	id, linked := hardLinkID(fi)
+	linked = linked && !p.opts.noHardLinks
+	if linked {
+		if first, seen := p.links[id]; seen {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			return p.writeHeader(hdr)
+		}
+	}
+
+	if p.opts.metadataOnly {
+		if linked {
+			p.links[id] = hdr.Name
+		}
+		toMetadataOnly(hdr)
+		p.addXattrs(hdr, srcFull)
+		return p.writeHeader(hdr)
+	}
+
+	//先打开文件再写入头，文件在ReadDir之后被删除时跳过，包中不会留下没有内容的项
+	var fr *os.File
+	if !p.dryRun {
+		fr, err = os.Open(srcFull)
+		if err != nil {
+			if p.vanished(srcRelative, err) {
+				return nil
+			}
+			return err
+		}
+		defer fr.Close()
+	}
+	//内容和已经打包的文件相同时记录为指向它的TypeLink
+	var dedupe *dedupeFile
+	if p.opts.dedupe && !p.opts.noHardLinks && !p.dryRun && hdr.Size > 0 {
+		first, self, err := p.findDuplicate(fr, srcFull, hdr, fi.ModTime())
+		if err != nil {
+			return err
+		}
+		if first != "" {
+			size := hdr.Size
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			if err := p.writeHeader(hdr); err != nil {
+				return err
+			}
+			p.stats.Deduplicated++
+			p.stats.DeduplicatedBytes += size
+			return nil
+		}
+		dedupe = self
+	}
+	if linked {
+		p.links[id] = hdr.Name
+	}
+	p.addXattrs(hdr, srcFull)
+	if p.opts.checksums && !p.dryRun {
+		err := addChecksum(hdr, func() (io.ReadCloser, error) {
+			return os.Open(srcFull)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := p.writeHeader(hdr); err != nil {
+		return err
+	}
+	if p.dryRun {
+		return nil
+	}
+	if err := p.copyFile(fr, hdr.Size); err != nil {
+		return err
+	}
+	if dedupe != nil {
+		p.addDedupe(dedupe, hdr.Size)
+	}
+	return nil
+}
+
+//文件在ReadDir之后被删除时只记录警告，不算错误，打包正在运行的程序的目录时经常出现
+func (p *packer) vanished(srcRelative string, err error) bool {
+	if !os.IsNotExist(err) {
+		return false
+	}
+	p.warn(filepath.ToSlash(srcRelative), WarnVanished, fmt.Errorf("打包时已被删除，已跳过：%w", err))
+	return true
+}
+
+//把文件的内容写入tar
+func (p *packer) copyFile(fr io.Reader, size int64) (err error) {
+	var w io.Writer = p.tw
+	if p.ctx.Done() != nil {
+		w = &ctxWriter{ctx: p.ctx, w: w}
+	}
+	if p.limiter != nil {
+		w = &rateWriter{w: w, l: p.limiter}
+	}
+	if p.progress.fn != nil {
+		w = &progressWriter{w: w, pg: &p.progress}
+		defer func() {
+			if err == nil {
+				p.progress.end()
+			}
+		}()
+	}
+
+	if p.opts.manifest != nil {
+		mh := newManifestHash(p.current, size)
+		w = io.MultiWriter(w, mh)
+		defer func() {
+			if err == nil {
+				p.addManifest(mh)
+			}
+		}()
+	}
+
+	if f, ok := fr.(*os.File); ok && p.opts.sparse {
+		if ok, err := copySparse(w, f, size); ok {
+			if err != nil {
+				p.broken = true
+			}
+			return err
+		}
+	}
+
+	//只复制头中记录的大小，文件在写入头之后变大或者变小时都不会破坏压缩包的结构
+	rr := &readCounter{r: fr}
+	n, err := copyBuffer(w, io.LimitReader(rr, size), p.opts.bufferSize)
+	if err == nil && n < size {
+		err = io.EOF
+	}
+	if err == io.EOF {
+		//文件变小了，用0补齐
+		p.warn(p.current, WarnChanged, fmt.Errorf("读取时文件变小了，缺少的%d字节已用0补齐", size-rr.n))
+		if err := writeZeros(w, size-rr.n); err != nil {
+			p.broken = true
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		if rr.err == nil {
+			//写入压缩包失败
+			p.broken = true
+			return err
+		}
+		//读取文件失败时用0补齐这一项，压缩包的结构仍然完整，ContinueOnError时可以继续打包其他的项
+		if err := writeZeros(p.tw, size-rr.n); err != nil {
+			p.broken = true
+		}
+		return err
+	}
+
+	//文件变大了，多出的内容不打包
+	var b [1]byte
+	if n, _ := fr.Read(b[:]); n > 0 {
+		p.warn(p.current, WarnChanged, fmt.Errorf("读取时文件变大了，只打包了前%d字节", size))
+	}
+	return nil
+}
+
+//记录读取的字节数和读取时的错误，用于区分读取文件和写入压缩包的错误
+type readCounter struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+//向w写入n个0
+func writeZeros(w io.Writer, n int64) error {
+	var zeros [32 * 1024]byte
+	for n > 0 {
+		m := int64(len(zeros))
+		if m > n {
+			m = n
+		}
+		if _, err := w.Write(zeros[:m]); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+//将命名管道、字符设备和块设备打包为TypeFifo、TypeChar和TypeBlock
+//只有tar头，设备的主次设备号由FileInfoHeader填写，不读取其中的数据
+func (p *packer) tarNode(srcFull string, srcRelative string, fi os.FileInfo) error {
+	hdr, err := p.header(fi, srcRelative, "")
+	if err != nil {
+		return err
+	}
+	p.addXattrs(hdr, srcFull)
+	return p.writeHeader(hdr)
+}
+
+//将符号链接本身打包为TypeSymlink，只记录链接的目标，没有内容，所以失效的链接也可以打包
+func (p *packer) tarSymlink(srcBase string, srcRelative string, fi os.FileInfo) error {
+	srcFull := srcBase+srcRelative
+	link, err := os.Readlink(srcFull)
+	if err != nil {
+		if p.vanished(srcRelative, err) {
+			return nil
+		}
+		return err
+	}
+	link = p.relativeLink(srcBase, srcFull, srcRelative, link)
+
+	hdr, err := p.header(fi, srcRelative, link)
+	if err != nil {
+		return err
+	}
+	return p.writeHeader(hdr)
+}
+
+//将.tar.gz的文件解压到dstDir文件夹下
+//srcTar是要解压的.tar.gz文件
+//dstDir是要解压到的目标文件夹
+//opts用于调整解压的行为
+func UnTar(srcTar string, dstDir string, opts ...Option) (err error) {
+	return UnTarContext(context.Background(), srcTar, dstDir, opts...)
+}
+
+//同UnTar，ctx取消时停止解压并返回包装了ctx.Err()的错误
+//每解压一项之前都会检查ctx，写入大文件的过程中也会检查
+func UnTarContext(ctx context.Context, srcTar string, dstDir string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	return unTarPath(ctx, srcTar, dstDir, o)
+}
+
+func unTarPath(ctx context.Context, srcTar string, dstDir string, o *options) error {
+	srcTar = filepath.FromSlash(srcTar)
+
+	o.decompressionFor(srcTar)
+
+	if !Exists(srcTar) {
+		return errors.New("要解压的文件不存在："+srcTar)
+	}
+
+	//打开要解压的文件
+	fr, err := os.Open(srcTar)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	return unTarFromReader(ctx, fr, dstDir, o)
+}
+
+//将r中的.tar.gz数据流解压到dstDir文件夹下
+//r可以是不支持Seek的数据流，例如http请求体、网络连接
+//dstDir是要解压到的目标文件夹
+func UnTarFromReader(r io.Reader, dstDir string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	return unTarFromReader(context.Background(), r, dstDir, o)
+}
+
+func unTarFromReader(ctx context.Context, r io.Reader, dstDir string, o *options) (err error) {
+	cr := &countingReader{r: r}
+	gr, err := newDecompressReader(cr, o)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	start := time.Now()
+	u := newUnpacker(ctx, dstDir, o)
+	u.compressed = &cr.n
+	logStart(o, "开始解压")
+	defer func() {
+		u.logFinish(err, time.Since(start))
+		u.fillStats(time.Since(start))
+	}()
+
+	if err := u.unTar(tar.NewReader(gr)); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("解压被取消：%w", ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
+
+//创建gzip.Reader，r不是有效的gzip数据时返回说明原因的错误
+func newGzipReader(r io.Reader) (*gzip.Reader, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		if err == gzip.ErrHeader || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("要解压的数据不是有效的gzip格式：%w", err)
+		}
+		return nil, err
+	}
+	return gr, nil
+}
+
+//读取.tar.gz文件的gzip头，例如WithGzipHeader设置的原始文件名、注释和时间，不需要解压
+func ReadGzipHeader(path string) (gzip.Header, error) {
+	fr, err := os.Open(path)
+	if err != nil {
+		return gzip.Header{}, err
+	}
+	defer fr.Close()
+
+	gr, err := newGzipReader(fr)
+	if err != nil {
+		return gzip.Header{}, err
+	}
+	defer gr.Close()
+	return gr.Header, nil
+}
+
+//解压过程中的状态，在各个unTarXxx之间传递
+type unpacker struct {
+	ctx    context.Context
+	opts   *options
+	dstDir string //以路径分隔符结尾的目标文件夹
+
+	//目录的权限等所有文件都解压完成后再设置，避免只读目录导致其下的文件无法写入
+	dirs []dirMode
+
+	limiter *rateLimiter  //WithRateLimit时所有文件共用的限速
+	errs    []*EntryError //ContinueOnError时出错的项
+
+	normalizer *normalizer //WithNormalizeExtractedNames时规范化包内的名称
+
+	entries    int    //已经开始解压的项数，用于WithMaxEntries
+	extracted  int64  //已经解压出的字节数，用于WithMaxExtractSize和WithMaxCompressionRatio
+	compressed *int64 //已经读取的压缩数据的字节数，WithMaxCompressionRatio时不为nil
+
+	created map[string]bool //这次解压写入过的路径，重复的项不算和已存在的文件冲突
+
+	stats Stats
+}
+
+func newUnpacker(ctx context.Context, dstDir string, o *options) *unpacker {
+	u := &unpacker{
+		ctx:  ctx,
+		opts: o,
+		//清理路径字符串
+		dstDir: filepath.Clean(dstDir) + string(os.PathSeparator),
+
+		limiter: newRateLimiter(ctx, o.rateLimit),
+
+		normalizer: newNormalizer(o.extractForm),
+		created:    make(map[string]bool),
+	}
+
+	if o.xattrs && !xattrSupported {
+		u.warn("", WarnXattr, errXattrUnsupported)
+	}
+	return u
+}
+
+//记录一个不影响解压结果的问题
+func (u *unpacker) warn(name string, category WarningCategory, err error) {
+	u.stats.Warnings = append(u.stats.Warnings, Warning{Name: name, Category: category, Err: err})
+	logWarning(u.opts, name, category, err)
+}
+
+//依次解压tr中的每一项
+func (u *unpacker) unTar(tr *tar.Reader) error {
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		if err != nil {
+			return err
+		}
+		if err := u.ctx.Err(); err != nil {
+			return err
+		}
+		if err := u.unTarEntry(tr, hdr); err != nil {
+			if err := u.entryFailed(hdr.Name, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	u.restoreDirs()
+	return multiError(u.errs)
+}
+
+//统计解压成功的一项
+func (u *unpacker) count(hdr *tar.Header) {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		u.stats.Dirs++
+	case tar.TypeReg:
+		u.stats.Files++
+		u.stats.Bytes += hdr.Size
+	default:
+		u.stats.Files++
+	}
+}
+
+//设置了WithStats时填写解压的统计信息
+func (u *unpacker) fillStats(elapsed time.Duration) {
+	if u.opts.stats == nil {
+		return
+	}
+	*u.opts.stats = u.stats
+	u.opts.stats.Errors = len(u.errs)
+	u.opts.stats.Elapsed = elapsed
+}
+
+//从里向外设置目录的权限
+func (u *unpacker) restoreDirs() {
+	for i := len(u.dirs) - 1; i >= 0; i-- {
+		os.Chmod(u.dirs[i].path, u.dirs[i].mode)
+		hdr := u.dirs[i].hdr
+		u.restoreTimes(u.dirs[i].path, hdr.Name, hdr.AccessTime, hdr.ModTime)
+		u.restoreWinAttrs(u.dirs[i].path, hdr)
+	}
+}
+
+//包内的名称解析后超出了解压目录时返回的错误，例如../../etc/passwd、/etc/passwd
+var ErrUnsafePath = errors.New("包内的路径超出了解压目录")
+
+//把包内的名称转换为解压目录下的路径，名称是绝对路径或者通过..超出解压目录时返回ErrUnsafePath
+//路径中已经解压出的符号链接同样会被拒绝，避免先解压一个指向外部的链接，再通过它写到解压目录之外
+func (u *unpacker) safePath(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(name, "/") ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w：%s", ErrUnsafePath, name)
+	}
+	if clean == "." {
+		return u.dstDir, nil
+	}
+
+	//逐级检查已经存在的父目录
+	dir := u.dstDir
+	parts := strings.Split(clean, string(os.PathSeparator))
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			break
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w：%s 经过了符号链接 %s", ErrUnsafePath, name, dir)
+		}
+	}
+	return u.dstDir + clean, nil
+}
+
+//解压一项，r是普通文件的内容
+func (u *unpacker) unTarEntry(r io.Reader, hdr *tar.Header) (err error) {
+	if err := u.checkEntry(hdr); err != nil {
+		return err
+	}
+	if u.opts.applyDeleted && hdr.Name == deletedListName {
+		return u.unTarDeleted(r)
+	}
+	if _, ok := metadataOnlySize(hdr); ok {
+		return ErrMetadataOnly
+	}
+	skipped := false
+	defer func() {
+		if err == nil && !skipped {
+			u.count(hdr)
+		}
+	}()
+	u.rawName(hdr)
+	if u.normalizer != nil {
+		if err := u.normalizer.normalize(hdr); err != nil {
+			return err
+		}
+	}
+
+	//获取文件信息
+	fi := hdr.FileInfo()
+
+	//获取绝对路径，不允许超出解压目录
+	dstDirFull, err := u.safePath(hdr.Name)
+	if err != nil {
+		return err
+	}
+	//已存在的目录不算冲突
+	if !fi.IsDir() {
+		if skipped, err = u.conflict(dstDirFull, hdr); skipped || err != nil {
+			return err
+		}
+	}
+
+	if fi.IsDir() {
+		//创建目录
+		err = os.MkdirAll(dstDirFull, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		u.restoreXattrs(dstDirFull, hdr)
+		u.dirs = append(u.dirs, dirMode{path: dstDirFull, mode: fi.Mode().Perm(), hdr: hdr})
+	} else if hdr.Typeflag == tar.TypeLink {
+		// 创建链接所在的目录
+		err = os.MkdirAll(filepath.Dir(dstDirFull), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		//硬链接的目标是包内的名称，指向已经解压出来的文件
+		target, err := u.safePath(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if u.opts.linksAsCopies {
+			return u.copyLinkTarget(hdr.Name, dstDirFull, target)
+		}
+		if err := unTarLink(dstDirFull, target); err != nil {
+			return err
+		}
+	} else if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock || hdr.Typeflag == tar.TypeFifo {
+		// 创建所在的目录
+		err = os.MkdirAll(filepath.Dir(dstDirFull), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		u.unTarNode(dstDirFull, hdr)
+	} else if hdr.Typeflag == tar.TypeSymlink {
+		// 创建链接所在的目录
+		err = os.MkdirAll(filepath.Dir(dstDirFull), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		//符号链接没有内容，也不需要设置权限
+		if err := unTarSymlink(dstDirFull, hdr.Linkname); err != nil {
+			return err
+		}
+	} else {
+		// 创建文件所在的目录
+		err = os.MkdirAll(filepath.Dir(dstDirFull), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		//将r中的数据写入到文件中
+		r = u.limitReader(hdr.Name, r)
+		if u.ctx.Done() != nil {
+			r = &ctxReader{ctx: u.ctx, r: r}
+		}
+		if u.limiter != nil {
+			r = &rateReader{r: r, l: u.limiter}
+		}
+		h := u.checksumHash(hdr)
+		if h != nil {
+			r = io.TeeReader(r, h)
+		}
+		if err := unTarFile(dstDirFull, r, u.opts.bufferSize); err != nil {
+			removeOverLimit(dstDirFull, err)
+			return err
+		}
+		if h != nil {
+			if err := u.verifyChecksum(hdr, h, dstDirFull); err != nil {
+				return err
+			}
+		}
+		u.restoreXattrs(dstDirFull, hdr)
+		os.Chmod(dstDirFull, fi.Mode().Perm())
+		u.restoreTimes(dstDirFull, hdr.Name, hdr.AccessTime, hdr.ModTime)
+		u.restoreWinAttrs(dstDirFull, hdr)
+	}
+
+	return nil
+}
+
+//创建设备文件或者命名管道，不支持或者没有权限时跳过并记录警告
+//设备文件只有设置了WithDevices才创建，命名管道不需要特殊权限，总是创建
+func (u *unpacker) unTarNode(dstFile string, hdr *tar.Header) {
+	if hdr.Typeflag != tar.TypeFifo && !u.opts.devices {
+		u.warn(hdr.Name, WarnUnsupported, errors.New("没有设置WithDevices，跳过设备文件"))
+		return
+	}
+
+	dstFile = filepath.FromSlash(dstFile)
+	if fi, err := os.Lstat(dstFile); err == nil && !fi.IsDir() {
+		if err := os.Remove(dstFile); err != nil {
+			u.warn(hdr.Name, WarnUnsupported, err)
+			return
+		}
+	}
+	if err := mknod(dstFile, hdr); err != nil {
+		u.warn(hdr.Name, WarnUnsupported, err)
+		return
+	}
+	//mknod受umask影响，和普通文件一样重新设置权限
+	os.Chmod(dstFile, hdr.FileInfo().Mode().Perm())
+}
+
+//按SCHILY.xattr.的约定从PAX记录中还原扩展属性，失败时只记录警告
+func (u *unpacker) restoreXattrs(dstFile string, hdr *tar.Header) {
+	if !u.opts.xattrs || !xattrSupported {
+		return
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		if err := setXattr(filepath.FromSlash(dstFile), name, value); err != nil {
+			u.warn(hdr.Name, WarnXattr, err)
+		}
+	}
+}
+
+//解压完成后要设置权限的目录
+type dirMode struct {
+	path string
+	mode os.FileMode
+	hdr  *tar.Header //WithRestoreTimes时用于设置时间
+}
+
+// 因为要在 defer 中关闭文件，所以要单独创建一个函数
+func unTarFile(dstFile string, r io.Reader, bufferSize int) (err error) {
+	dstFile = filepath.FromSlash(dstFile)
+
+	//已存在的符号链接先删除，os.Create会跟随链接写到链接指向的文件中
+	if fi, err := os.Lstat(dstFile); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dstFile); err != nil {
+			return err
+		}
+	}
+
+	// 创建空文件，准备写入解包后的数据
+	fw, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		//网络文件系统等可能在Close时才报告空间不足之类的写入错误
+		if er := fw.Close(); er != nil && err == nil {
+			err = er
+		}
+	}()
+
+	if _, err := copyBuffer(fw, r, bufferSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+//创建硬链接，和解压普通文件一样会替换掉已存在的文件
+func unTarLink(dstFile string, target string) error {
+	dstFile = filepath.FromSlash(dstFile)
+	if fi, err := os.Lstat(dstFile); err == nil && !fi.IsDir() {
+		if err := os.Remove(dstFile); err != nil {
+			return err
+		}
+	}
+	return os.Link(filepath.FromSlash(target), dstFile)
+}
+
+//创建符号链接，和解压普通文件一样会替换掉已存在的文件
+func unTarSymlink(dstFile string, link string) error {
+	dstFile = filepath.FromSlash(dstFile)
+	if fi, err := os.Lstat(dstFile); err == nil && !fi.IsDir() {
+		if err := os.Remove(dstFile); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(link, dstFile)
 }
 
 //判断文件或者目录是否存在
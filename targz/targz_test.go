@@ -0,0 +1,62 @@
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//在root下按files创建文件，键是以`/`分隔的相对路径，值是内容
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+//返回压缩包中所有项的名称，按字典序排列
+func archiveNames(t *testing.T, archive string, opts ...Option) []string {
+	t.Helper()
+	entries, err := List(archive, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//dest在要打包的目录下并且已经存在时，第二次打包也不能把它打包进去
+func TestTarSkipsDestInsideSrc(t *testing.T) {
+	for _, direct := range []bool{false, true} {
+		src := t.TempDir()
+		writeTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+		dest := filepath.Join(src, "sub", "backup.tar.gz")
+
+		opts := []Option{WithOverwrite()}
+		if direct {
+			opts = append(opts, WithDirectWrite())
+		}
+		for run := 0; run < 2; run++ {
+			if err := TarWithOptions(src, dest, opts...); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range archiveNames(t, dest) {
+				if strings.HasSuffix(name, "backup.tar.gz") || strings.Contains(name, ".tmp-") || strings.Contains(name, ".bak-") {
+					t.Fatalf("direct=%v 第%d次打包包含了自己：%s", direct, run+1, name)
+				}
+			}
+		}
+	}
+}
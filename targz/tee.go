@@ -0,0 +1,59 @@
+package targz
+
+import (
+	"fmt"
+	"io"
+)
+
+//把生成的压缩包同时写入ws，例如在写入本地文件的同时上传，只需要读取和压缩一次
+//按顺序先写入原来的目标，再依次写入ws；任何一个失败都会停止打包，ws的失败返回*TeeError
+//ws由调用者负责关闭，可以和Tar、TarToWriter等所有生成压缩包的函数一起使用
+func WithTee(ws ...io.Writer) Option {
+	return func(o *options) error {
+		for i, w := range ws {
+			if w == nil {
+				return fmt.Errorf("WithTee的第%d个Writer为nil", i)
+			}
+		}
+		o.tees = append(o.tees, ws...)
+		return nil
+	}
+}
+
+//写入WithTee指定的Writer失败，Index是它在所有WithTee参数中的位置，从0开始
+type TeeError struct {
+	Index  int
+	Writer io.Writer
+	Err    error
+}
+
+func (e *TeeError) Error() string {
+	return fmt.Sprintf("写入第%d个tee目标失败：%v", e.Index, e.Err)
+}
+
+func (e *TeeError) Unwrap() error {
+	return e.Err
+}
+
+//把数据依次写入w和tees，和io.MultiWriter一样，但失败时指明是哪一个
+type teeWriter struct {
+	w    io.Writer
+	tees []io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for i, w := range t.tees {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return 0, &TeeError{Index: i, Writer: w, Err: err}
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+package targz
+
+import (
+	"archive/tar"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//保存创建时间的PAX记录，和libarchive（bsdtar）使用的相同
+const birthTimePAXKey = "LIBARCHIVE.creationtime"
+
+//打包时保存访问时间、状态改变时间和创建时间，时间精确到纳秒
+//平台提供的时间才会保存：Linux没有创建时间，Windows没有状态改变时间；创建时间保存在PAX记录LIBARCHIVE.creationtime中
+//没有用WithFormat指定格式时使用PAX格式，不能和USTAR、GNU格式或者WithoutExtraTimes同时使用
+func WithExtendedTimes() Option {
+	return func(o *options) error {
+		o.extendedTimes = true
+		return nil
+	}
+}
+
+//解压时把文件和目录的修改时间、访问时间恢复为包中记录的时间，没有记录访问时间时使用修改时间
+//目录的时间在所有文件解压完成之后设置；符号链接的时间和创建时间无法设置，保持不变
+func WithRestoreTimes() Option {
+	return func(o *options) error {
+		o.restoreTimes = true
+		return nil
+	}
+}
+
+//WithExtendedTimes时补充平台提供的访问时间，把创建时间保存到PAX记录中
+func (p *packer) addTimes(hdr *tar.Header, fi os.FileInfo) {
+	atime, birth := fileTimes(fi)
+	if hdr.AccessTime.IsZero() {
+		hdr.AccessTime = atime
+	}
+	if !birth.IsZero() {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords[birthTimePAXKey] = formatPAXTime(birth)
+	}
+}
+
+//按PAX的格式表示时间：秒数加上去掉了末尾0的小数部分
+func formatPAXTime(t time.Time) string {
+	sec, nsec := t.Unix(), t.Nanosecond()
+	sign := ""
+	if sec < 0 {
+		//PAX的小数部分和秒数同号，例如-1.5秒的Unix()是-2，Nanosecond()是5e8
+		sign, sec = "-", -sec
+		if nsec > 0 {
+			sec, nsec = sec-1, 1e9-nsec
+		}
+	}
+	s := sign + strconv.FormatInt(sec, 10)
+	if nsec > 0 {
+		s += "." + strings.TrimRight(strconv.Itoa(1e9 + nsec)[1:], "0")
+	}
+	return s
+}
+
+//WithRestoreTimes时设置解压出的文件的时间，失败时只记录警告
+func (u *unpacker) restoreTimes(dstFile string, name string, atime, mtime time.Time) {
+	if !u.opts.restoreTimes {
+		return
+	}
+	if atime.IsZero() {
+		atime = mtime
+	}
+	if err := os.Chtimes(dstFile, atime, mtime); err != nil {
+		u.warn(name, WarnMetadata, err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || netbsd
+
+package targz
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+//文件的创建时间和tar.FileInfoHeader没有填写的访问时间，平台不提供时为零值
+//这些平台上FileInfoHeader已经填写了访问时间
+func fileTimes(fi os.FileInfo) (atime time.Time, birth time.Time) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		birth = time.Unix(int64(st.Birthtimespec.Sec), int64(st.Birthtimespec.Nsec))
+	}
+	return atime, birth
+}
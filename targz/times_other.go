@@ -0,0 +1,14 @@
+//go:build !darwin && !freebsd && !netbsd && !windows
+
+package targz
+
+import (
+	"os"
+	"time"
+)
+
+//文件的创建时间和tar.FileInfoHeader没有填写的访问时间，平台不提供时为零值
+//Linux等平台的stat没有创建时间，访问时间已经由FileInfoHeader填写
+func fileTimes(fi os.FileInfo) (atime time.Time, birth time.Time) {
+	return atime, birth
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package targz
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+//文件的创建时间和tar.FileInfoHeader没有填写的访问时间，平台不提供时为零值
+func fileTimes(fi os.FileInfo) (atime time.Time, birth time.Time) {
+	if d, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		atime = time.Unix(0, d.LastAccessTime.Nanoseconds())
+		birth = time.Unix(0, d.CreationTime.Nanoseconds())
+	}
+	return atime, birth
+}
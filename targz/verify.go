@@ -0,0 +1,111 @@
+package targz
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+//生成压缩包之后重新读取一遍，确认压缩数据完整、每一项都能读出、大小和写入时一致，
+//有WithChecksums的记录时同时比较SHA-256；在Rename为目标文件之前进行，校验失败时不会留下压缩包
+//只能用于生成文件的函数，例如Tar、TarFromList、NewWriter；TarToWriter的w必须是可以读取的*os.File
+func WithVerify() Option {
+	return func(o *options) error {
+		o.verify = true
+		return nil
+	}
+}
+
+//重新读取压缩包时发现的问题，可以用errors.Is(err, ErrVerifyFailed)判断
+var ErrVerifyFailed = errors.New("压缩包校验失败")
+
+//写入时记录的一项，用于和重新读出的内容比较
+type verifyEntry struct {
+	name string
+	size int64
+}
+
+//开始写入时记下压缩包所在的文件和起始位置
+func newVerifyTarget(w io.Writer) (*os.File, int64, error) {
+	f, ok := w.(*os.File)
+	if !ok {
+		return nil, 0, errors.New("WithVerify只能用于生成文件的函数")
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, fmt.Errorf("WithVerify无法定位压缩包的位置：%w", err)
+	}
+	return f, offset, nil
+}
+
+//从r中读出整个压缩包，和写入时记录的want逐项比较
+func verifyArchive(r io.Reader, o *options, want []verifyEntry) error {
+	gr, err := newDecompressReader(r, o)
+	if err != nil {
+		return fmt.Errorf("%w：%v", ErrVerifyFailed, err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	i := 0
+	for ; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w：读取第%d项失败：%v", ErrVerifyFailed, i+1, err)
+		}
+		if i >= len(want) {
+			return fmt.Errorf("%w：多出了%s", ErrVerifyFailed, hdr.Name)
+		}
+		if err := verifyEntryContent(tr, hdr, want[i]); err != nil {
+			return err
+		}
+	}
+	if i < len(want) {
+		return fmt.Errorf("%w：缺少%s等%d项", ErrVerifyFailed, want[i].name, len(want)-i)
+	}
+
+	//读到压缩数据的末尾，gzip等格式在这时才检查结尾的校验和
+	if _, err := io.Copy(ioutil.Discard, gr); err != nil {
+		return fmt.Errorf("%w：%v", ErrVerifyFailed, err)
+	}
+	return nil
+}
+
+//比较一项的名称和大小，读出全部内容，有SHA-256记录时同时比较
+func verifyEntryContent(tr *tar.Reader, hdr *tar.Header, want verifyEntry) error {
+	if hdr.Name != want.name {
+		return fmt.Errorf("%w：应为%s，读出的是%s", ErrVerifyFailed, want.name, hdr.Name)
+	}
+	if hdr.Size != want.size {
+		return fmt.Errorf("%w：%s的大小应为%d，读出的是%d", ErrVerifyFailed, hdr.Name, want.size, hdr.Size)
+	}
+
+	var h hash.Hash
+	var w io.Writer = ioutil.Discard
+	if _, ok := hdr.PAXRecords[checksumPAXKey]; ok {
+		h = sha256.New()
+		w = h
+	}
+	n, err := io.Copy(w, tr)
+	if err != nil {
+		return fmt.Errorf("%w：读取%s失败：%v", ErrVerifyFailed, hdr.Name, err)
+	}
+	if n != want.size && hdr.Typeflag == tar.TypeReg {
+		return fmt.Errorf("%w：%s只读出了%d字节，应为%d", ErrVerifyFailed, hdr.Name, n, want.size)
+	}
+	if h != nil {
+		if got, want := hex.EncodeToString(h.Sum(nil)), hdr.PAXRecords[checksumPAXKey]; got != want {
+			return fmt.Errorf("%w：%v", ErrVerifyFailed, &ChecksumError{Name: hdr.Name, Want: want, Got: got})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package targz
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//用n个goroutine预先读取即将遍历的子目录，读取目录和获取文件信息在NFS等延迟较高的文件系统上可以并行进行
+//写入仍然只在一个goroutine中按名称顺序进行，打包的结果和不设置时完全相同；n为1时不预读，默认为1
+//预读的目录数不超过n的4倍，被排除的目录可能已经被读取过一次，但不会打包
+func WithWalkConcurrency(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return errors.New("遍历的并发数必须大于0")
+		}
+		o.walkConcurrency = n
+		return nil
+	}
+}
+
+//读取目录下的所有文件，结果按名称排序
+var readDir = ioutil.ReadDir
+
+//在后台预读子目录
+type dirPrefetcher struct {
+	jobs  chan *dirListing
+	limit int //同时预读和等待使用的目录数
+
+	mu      sync.Mutex
+	pending map[string]*dirListing //键为目录的完整路径
+	wg      sync.WaitGroup
+}
+
+//一个目录的读取结果，done关闭之后fis和err才有效
+type dirListing struct {
+	path string
+	done chan struct{}
+	fis  []os.FileInfo
+	err  error
+}
+
+//WithWalkConcurrency大于1时开始预读，返回遍历结束时调用的函数
+func (p *packer) startPrefetch() func() {
+	n := p.opts.walkConcurrency
+	if n <= 1 || p.prefetch != nil {
+		return func() {}
+	}
+	f := &dirPrefetcher{
+		jobs:    make(chan *dirListing, n*4),
+		limit:   n * 4,
+		pending: make(map[string]*dirListing),
+	}
+	for i := 0; i < n; i++ {
+		f.wg.Add(1)
+		go f.work()
+	}
+	p.prefetch = f
+	return func() {
+		close(f.jobs)
+		f.wg.Wait()
+		p.prefetch = nil
+	}
+}
+
+func (f *dirPrefetcher) work() {
+	defer f.wg.Done()
+	for l := range f.jobs {
+		l.fis, l.err = readDir(l.path)
+		close(l.done)
+	}
+}
+
+//读取目录，已经预读时等待预读的结果
+func (f *dirPrefetcher) read(dir string) ([]os.FileInfo, error) {
+	if f == nil {
+		return readDir(dir)
+	}
+	f.mu.Lock()
+	l := f.pending[dir]
+	delete(f.pending, dir)
+	f.mu.Unlock()
+	if l == nil {
+		return readDir(dir)
+	}
+	<-l.done
+	return l.fis, l.err
+}
+
+//即将处理fis[i]时，从fis[next:]中依次预读子目录，直到预读的目录数达到上限，返回下一次开始的位置
+//dir是fis所在目录的完整路径；已经处理过的项不再预读
+func (f *dirPrefetcher) ahead(dir string, fis []os.FileInfo, next int, i int) int {
+	if f == nil {
+		return len(fis)
+	}
+	if next < i {
+		next = i
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ; next < len(fis) && len(f.pending) < f.limit; next++ {
+		if !fis[next].IsDir() {
+			continue
+		}
+		l := &dirListing{path: childPath(dir, fis[next].Name()), done: make(chan struct{})}
+		select {
+		case f.jobs <- l:
+			f.pending[l.path] = l
+		default:
+			return next
+		}
+	}
+	return next
+}
+
+//dir下的name已经处理完，被排除或者出错没有读取时丢弃预读的结果
+func (f *dirPrefetcher) drop(dir string, name string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	delete(f.pending, childPath(dir, name))
+	f.mu.Unlock()
+}
+
+//和遍历时拼接出的路径一致，dir可以以分隔符结尾
+func childPath(dir string, name string) string {
+	return strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator) + name
+}
@@ -0,0 +1,83 @@
+package targz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//生成dirs个目录，每个目录下有subs个子目录，每个子目录下有一个文件
+func walkTree(tb testing.TB, dirs int, subs int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for i := 0; i < dirs; i++ {
+		for j := 0; j < subs; j++ {
+			dir := filepath.Join(root, fmt.Sprintf("d%02d", i), fmt.Sprintf("s%d", j))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				tb.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "f"), []byte(dir), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+//模拟延迟较高的文件系统，每次读取目录都等待delay
+func slowReadDir(tb testing.TB, delay time.Duration) {
+	old := readDir
+	readDir = func(dir string) ([]os.FileInfo, error) {
+		time.Sleep(delay)
+		return old(dir)
+	}
+	tb.Cleanup(func() { readDir = old })
+}
+
+//并行预读目录时打包的结果和串行遍历完全相同
+func TestWalkConcurrency(t *testing.T) {
+	src := walkTree(t, 20, 5)
+	slowReadDir(t, time.Millisecond)
+
+	var outputs [][]byte
+	for _, n := range []int{1, 2, 8, 32} {
+		var buf bytes.Buffer
+		if err := TarToWriter(src, &buf, WithCompression(None), WithWalkConcurrency(n)); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, buf.Bytes())
+	}
+	for i := 1; i < len(outputs); i++ {
+		if !bytes.Equal(outputs[0], outputs[i]) {
+			t.Fatalf("第%d种并发数打包的结果不同", i+1)
+		}
+	}
+
+	//被排除的目录可能已经预读过，但不会打包
+	got := planNames(t, src, WithWalkConcurrency(8), WithExclude("d0*"))
+	if len(got) != 10*(1+5*2) {
+		t.Fatalf("排除之后有%d项", len(got))
+	}
+	if err := WithWalkConcurrency(0)(&options{}); err == nil {
+		t.Fatal("并发数为0没有返回错误")
+	}
+}
+
+//每次读取目录有1ms延迟时不同并发数的耗时
+func BenchmarkWalkConcurrency(b *testing.B) {
+	src := walkTree(b, 20, 5)
+	slowReadDir(b, time.Millisecond)
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := TarToWriter(src, io.Discard, WithCompression(None), WithWalkConcurrency(n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
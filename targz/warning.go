@@ -0,0 +1,69 @@
+package targz
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//警告的类别，用于按类别决定是否忽略
+type WarningCategory int
+
+const (
+	WarnOther        WarningCategory = iota //其他
+	WarnUnsupported                         //无法打包或者还原的文件类型，例如套接字、没有设置WithDevices时的设备文件，已跳过
+	WarnUnreadable                          //无法读取的文件信息或者忽略文件
+	WarnVanished                            //打包时文件已被删除，已跳过
+	WarnChanged                             //读取时文件的大小发生了变化
+	WarnLoop                                //符号链接或者绑定挂载造成的目录循环，已跳过
+	WarnMountPoint                          //WithOneFileSystem时跳过的其他文件系统的挂载点
+	WarnSelfArchive                         //正在写入的压缩包本身，已跳过
+	WarnXattr                               //扩展属性无法读取或者还原
+	WarnMetadata                            //时间、Windows属性等无法还原
+	WarnEncoding                            //文件名无法按指定的编码转换
+	WarnChecksum                            //VerifyWarn时SHA-256不一致
+	WarnExternalLink                        //WithRelativeSymlinks时指向打包的目录之外的绝对路径符号链接
+	WarnExisting                            //解压时目标位置已经有文件，按WithExtractOverwrite保留了它
+)
+
+var warningCategoryNames = [...]string{
+	WarnOther:        "other",
+	WarnUnsupported:  "unsupported",
+	WarnUnreadable:   "unreadable",
+	WarnVanished:     "vanished",
+	WarnChanged:      "changed",
+	WarnLoop:         "loop",
+	WarnMountPoint:   "mount",
+	WarnSelfArchive:  "self",
+	WarnXattr:        "xattr",
+	WarnMetadata:     "metadata",
+	WarnEncoding:     "encoding",
+	WarnChecksum:     "checksum",
+	WarnExternalLink: "externallink",
+	WarnExisting:     "existing",
+}
+
+func (c WarningCategory) String() string {
+	if c >= 0 && int(c) < len(warningCategoryNames) {
+		return warningCategoryNames[c]
+	}
+	return "WarningCategory(" + strconv.Itoa(int(c)) + ")"
+}
+
+//不影响结果的问题，例如跳过了套接字、无法读取扩展属性，打包和解压仍然成功
+//通过WithStats得到的Stats.Warnings中按发生的顺序列出
+type Warning struct {
+	Name     string          //包内的名称，和整个操作有关时为空
+	Category WarningCategory //类别
+	Err      error           //原因
+}
+
+func (w Warning) Error() string {
+	if w.Name == "" {
+		return fmt.Sprintf("%v：%v", w.Category, w.Err)
+	}
+	return fmt.Sprintf("%s：%v", w.Name, w.Err)
+}
+
+func (w Warning) Unwrap() error {
+	return w.Err
+}
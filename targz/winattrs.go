@@ -0,0 +1,82 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//保存Windows文件属性的PAX记录，值为以`,`分隔的属性名称，例如readonly,hidden
+const winAttrsPAXKey = "GOUTILS.winattrs"
+
+//保存和还原的Windows文件属性
+const (
+	winAttrReadOnly = 1 << iota
+	winAttrHidden
+	winAttrSystem
+	winAttrArchive
+)
+
+//属性在PAX记录中的名称
+var winAttrNames = []struct {
+	attr uint32
+	name string
+}{
+	{winAttrReadOnly, "readonly"},
+	{winAttrHidden, "hidden"},
+	{winAttrSystem, "system"},
+	{winAttrArchive, "archive"},
+}
+
+//在Windows上打包时把文件和目录的只读、隐藏、系统和存档属性保存在PAX记录GOUTILS.winattrs中，解压时在Windows上还原
+//其他平台上打包时没有这些属性，解压时忽略这条记录；还原失败只记录警告；只能用于PAX格式
+func WithWindowsAttributes() Option {
+	return func(o *options) error {
+		o.winAttrs = true
+		return nil
+	}
+}
+
+//把fi的Windows属性保存到hdr的PAX记录中，没有需要保存的属性时不添加记录
+func addWinAttrs(hdr *tar.Header, fi os.FileInfo) {
+	attrs, ok := winAttrs(fi)
+	if !ok || attrs == 0 {
+		return
+	}
+	var names []string
+	for _, a := range winAttrNames {
+		if attrs&a.attr != 0 {
+			names = append(names, a.name)
+		}
+	}
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	hdr.PAXRecords[winAttrsPAXKey] = strings.Join(names, ",")
+}
+
+//按GOUTILS.winattrs记录设置解压出的文件的属性，必须在写入内容、设置权限和时间之后调用，否则只读属性会导致失败
+func (u *unpacker) restoreWinAttrs(dstFile string, hdr *tar.Header) {
+	v, ok := hdr.PAXRecords[winAttrsPAXKey]
+	if !u.opts.winAttrs || !winAttrsSupported || !ok {
+		return
+	}
+
+	var attrs uint32
+	for _, name := range strings.Split(v, ",") {
+		known := false
+		for _, a := range winAttrNames {
+			if a.name == name {
+				attrs |= a.attr
+				known = true
+			}
+		}
+		if !known {
+			u.warn(hdr.Name, WarnMetadata, fmt.Errorf("未知的Windows属性：%s", name))
+		}
+	}
+	if err := setWinAttrs(dstFile, attrs); err != nil {
+		u.warn(hdr.Name, WarnMetadata, err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package targz
+
+import (
+	"errors"
+	"os"
+)
+
+const winAttrsSupported = false
+
+//这个平台没有Windows文件属性
+func winAttrs(fi os.FileInfo) (uint32, bool) {
+	return 0, false
+}
+
+func setWinAttrs(name string, attrs uint32) error {
+	return errors.New("这个平台不支持Windows文件属性")
+}
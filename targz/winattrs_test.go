@@ -0,0 +1,51 @@
+//go:build !windows
+
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//其他平台解压时忽略GOUTILS.winattrs记录，不产生警告
+func TestWindowsAttributesIgnored(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	hdr := &tar.Header{
+		Name:       "ro.txt",
+		Mode:       0644,
+		Size:       1,
+		Typeflag:   tar.TypeReg,
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{winAttrsPAXKey: "readonly,hidden"},
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("r")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats Stats
+	dst := t.TempDir()
+	if err := UnTarBytes(buf.Bytes(), dst, WithWindowsAttributes(), WithStats(&stats)); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Warnings) != 0 {
+		t.Fatalf("产生了警告：%v", stats.Warnings)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "ro.txt")); err != nil || string(data) != "r" {
+		t.Fatalf("解压的内容是%q：%v", data, err)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build windows
+
+package targz
+
+import (
+	"os"
+	"syscall"
+)
+
+const winAttrsSupported = true
+
+//winAttrNames中的属性对应的FILE_ATTRIBUTE_*
+var winAttrFlags = []struct {
+	attr uint32
+	flag uint32
+}{
+	{winAttrReadOnly, syscall.FILE_ATTRIBUTE_READONLY},
+	{winAttrHidden, syscall.FILE_ATTRIBUTE_HIDDEN},
+	{winAttrSystem, syscall.FILE_ATTRIBUTE_SYSTEM},
+	{winAttrArchive, syscall.FILE_ATTRIBUTE_ARCHIVE},
+}
+
+//读取文件的只读、隐藏、系统和存档属性
+func winAttrs(fi os.FileInfo) (uint32, bool) {
+	d, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return 0, false
+	}
+	var attrs uint32
+	for _, f := range winAttrFlags {
+		if d.FileAttributes&f.flag != 0 {
+			attrs |= f.attr
+		}
+	}
+	return attrs, true
+}
+
+//设置文件的只读、隐藏、系统和存档属性，文件的其他属性保持不变
+func setWinAttrs(name string, attrs uint32) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	cur, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return err
+	}
+	for _, f := range winAttrFlags {
+		if attrs&f.attr != 0 {
+			cur |= f.flag
+		} else {
+			cur &^= f.flag
+		}
+	}
+	return syscall.SetFileAttributes(p, cur)
+}
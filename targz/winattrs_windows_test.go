@@ -0,0 +1,59 @@
+//go:build windows
+
+package targz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//在Windows上打包时保存只读和隐藏属性，解压时还原
+func TestWindowsAttributes(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"ro.txt": "r", "hidden/h.txt": "h", "plain.txt": "p"})
+	attrs := map[string]uint32{
+		"ro.txt": winAttrReadOnly,
+		"hidden": winAttrHidden,
+	}
+	for name, a := range attrs {
+		path := filepath.Join(src, name)
+		if err := setWinAttrs(path, a); err != nil {
+			t.Fatal(err)
+		}
+		//只读文件会导致t.TempDir无法清理
+		t.Cleanup(func() { setWinAttrs(path, 0) })
+	}
+
+	dest := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := TarWithOptions(src, dest, WithWindowsAttributes()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := tarHeaders(t, data)
+	for name, want := range map[string]string{"ro.txt": "readonly", "hidden/": "hidden"} {
+		if got := headers[name].PAXRecords[winAttrsPAXKey]; got != want {
+			t.Errorf("%s的属性记录是%q，应为%q", name, got, want)
+		}
+	}
+
+	dst := t.TempDir()
+	if err := UnTar(dest, dst, WithWindowsAttributes()); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]uint32{"ro.txt": winAttrReadOnly, "hidden": winAttrHidden, "plain.txt": 0} {
+		path := filepath.Join(dst, name)
+		t.Cleanup(func() { setWinAttrs(path, 0) })
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//存档属性由系统在写入时设置，不比较
+		if got, _ := winAttrs(fi); got&^winAttrArchive != want {
+			t.Errorf("%s的属性是%b，应为%b", name, got, want)
+		}
+	}
+}
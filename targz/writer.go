@@ -0,0 +1,182 @@
+package targz
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//逐步生成压缩包，可以依次加入多个目录、文件和不在磁盘上的内容，最后由Close完成
+//所有的名称都是以`/`分隔的包内名称，不受WithStripPrefix、WithAddPrefix影响，除同名的目录外不能重复
+//某一项失败时按WithErrorPolicy处理：FailFast时之后的调用都返回这个错误，Close删除写了一半的文件
+//Writer不能在多个goroutine中同时使用
+type Writer struct {
+	d      *destFile
+	t      *tarOutput
+	err    error //FailFast时第一个失败的错误
+	closed bool
+}
+
+//创建dest并返回写入它的Writer，dest的处理和TarWithOptions相同：先写入临时文件，Close成功后才Rename为dest
+//opts中的WithExtraEntry在Close时写入
+func NewWriter(dest string, opts ...Option) (*Writer, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.compressionFor(dest); err != nil {
+		return nil, err
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTarOutput(context.Background(), d.f, o)
+	if err != nil {
+		d.abort()
+		return nil, err
+	}
+	t.p.unique = true
+	return &Writer{d: d, t: t}, nil
+}
+
+//以name作为包内的目录名称，打包目录dir及其下的所有内容
+func (w *Writer) AddDir(name string, dir string) error {
+	return w.add(name, dir, true)
+}
+
+//以name作为包内的名称，打包文件file
+func (w *Writer) AddFile(name string, file string) error {
+	return w.add(name, file, false)
+}
+
+//写入一项不在磁盘上的内容，hdr.Name是包内的名称，普通文件的内容从r中读取，必须正好是hdr.Size字节
+//hdr按原样写入，不受WithModeMask、WithOwner等选项影响；其他类型的项r可以为nil
+func (w *Writer) AddEntry(hdr *tar.Header, r io.Reader) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	h := *hdr
+	clean, ok := cleanEntryName(h.Name)
+	if !ok {
+		return errors.New("包内的名称不合法：" + h.Name)
+	}
+	h.Name = clean
+	if h.Typeflag == tar.TypeDir {
+		h.Name += "/"
+	}
+
+	return w.run(clean, func(p *packer) error {
+		if err := p.writeHeader(&h); err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg || h.Size == 0 {
+			return nil
+		}
+		if r == nil {
+			return errors.New("没有提供内容：" + h.Name)
+		}
+		return p.copyFile(&exactReader{r: r, n: h.Size}, h.Size)
+	})
+}
+
+//结束压缩包：写入WithExtraEntry的项，关闭tar和压缩，最后Rename为dest
+//任何一步失败都会删除写了一半的文件并返回原因；ContinueOnError时部分项出错，压缩包照常保存，返回*MultiError
+func (w *Writer) Close() (err error) {
+	if w.closed {
+		return errors.New("Writer已经关闭")
+	}
+	w.closed = true
+
+	err = w.err
+	if err == nil {
+		err = w.t.p.tarExtras()
+	}
+	err = w.t.close(err)
+	return w.d.finish(err)
+}
+
+//打包磁盘上的path，以name作为它在包内的名称
+func (w *Writer) add(name string, path string, isDir bool) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	clean, ok := cleanEntryName(name)
+	if !ok {
+		return errors.New("包内的名称不合法：" + name)
+	}
+
+	return w.run(clean, func(p *packer) error {
+		src, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() != isDir {
+			if isDir {
+				return errors.New("不是目录：" + path)
+			}
+			return errors.New("不是文件：" + path)
+		}
+		return p.tarAs(clean, src)
+	})
+}
+
+//以name作为src在包内的名称打包，src是目录时其下的内容都在name之下
+//name必须是cleanEntryName处理过的名称，src必须是绝对路径
+func (p *packer) tarAs(name string, src string) error {
+	base := filepath.Base(src)
+	if base == string(os.PathSeparator) || base == "." {
+		return errors.New("无法打包根目录：" + src)
+	}
+
+	//通过改写前缀把src在包内的名称替换为name
+	o := p.opts
+	strip, add := o.stripPrefix, o.addPrefix
+	o.stripPrefix, o.addPrefix = filepath.ToSlash(base), name
+	defer func() {
+		o.stripPrefix, o.addPrefix = strip, add
+	}()
+	return p.tarRooted(src)
+}
+
+//已经关闭或者FailFast时已经失败的Writer不能再使用
+func (w *Writer) check() error {
+	if w.closed {
+		return errors.New("Writer已经关闭")
+	}
+	return w.err
+}
+
+//执行一次加入，按WithErrorPolicy处理错误
+func (w *Writer) run(name string, fn func(p *packer) error) error {
+	p := w.t.p
+	if err := p.entryFailed(name, fn(p)); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+//期望读出n字节，内容提前结束时返回io.ErrUnexpectedEOF，让copyFile按读取失败处理
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	if err == io.EOF && r.n > 0 {
+		err = fmt.Errorf("内容比头中记录的少%d字节：%w", r.n, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
@@ -0,0 +1,48 @@
+package targz
+
+import (
+	"strings"
+	"syscall"
+)
+
+//这个平台是否支持扩展属性
+const xattrSupported = true
+
+//读取文件的所有扩展属性，会跟随符号链接，调用者需要保证path不是符号链接
+func listXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	//属性名以\0分隔
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, value)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[name] = string(value[:size])
+	}
+	return xattrs, nil
+}
+
+//设置文件的一个扩展属性
+func setXattr(path string, name string, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
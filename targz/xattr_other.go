@@ -0,0 +1,14 @@
+//go:build !linux
+
+package targz
+
+//这个平台是否支持扩展属性
+const xattrSupported = false
+
+func listXattrs(path string) (map[string]string, error) {
+	return nil, errXattrUnsupported
+}
+
+func setXattr(path string, name string, value string) error {
+	return errXattrUnsupported
+}
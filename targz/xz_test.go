@@ -0,0 +1,72 @@
+package targz
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//打包的.tar.xz可以用tar -xJf解压，tar -cJf生成的.tar.xz也可以用UnTar解压
+func TestXzWithTarCommand(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("没有tar命令")
+	}
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("没有xz命令")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := map[string]string{"a.txt": "hello", "b/c.txt": "world"}
+	writeTree(t, src, files)
+	check := func(root string) {
+		t.Helper()
+		for name, content := range files {
+			data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+			if err != nil || string(data) != content {
+				t.Fatalf("%s的内容是%q：%v", name, data, err)
+			}
+		}
+	}
+
+	for _, preset := range []int{0, 6, 9} {
+		dest := filepath.Join(dir, "out.tar.xz")
+		if err := TarWithOptions(src, dest, WithOverwrite(), WithXzPreset(preset)); err != nil {
+			t.Fatal(err)
+		}
+		out := t.TempDir()
+		if data, err := exec.Command("tar", "-xJf", dest, "-C", out).CombinedOutput(); err != nil {
+			t.Fatalf("预设级别%d：tar -xJf失败：%s", preset, data)
+		}
+		check(out)
+	}
+
+	archive := filepath.Join(dir, "cmd.tar.xz")
+	if data, err := exec.Command("tar", "-cJf", archive, "-C", src, ".").CombinedOutput(); err != nil {
+		t.Fatalf("tar -cJf失败：%s", data)
+	}
+	out := t.TempDir()
+	if err := UnTar(archive, out); err != nil {
+		t.Fatal(err)
+	}
+	check(out)
+
+	//内存中的数据用WithCompression指定格式
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnTarToMap(data, WithCompression(Xz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"./a.txt": []byte("hello"), "./b/c.txt": []byte("world")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("UnTarToMap的结果是%q", got)
+	}
+
+	if err := TarWithOptions(src, filepath.Join(dir, "bad.tar.xz"), WithXzPreset(10)); err == nil {
+		t.Fatal("不合法的预设级别没有返回错误")
+	}
+}
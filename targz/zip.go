@@ -0,0 +1,192 @@
+package targz
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//将文件或者目录打成.zip文件，和Tar使用同样的遍历规则和选项，例如WithExclude、WithFilter、WithOverwriteMode
+//文件的Unix权限保存在外部属性中，目录的名称以`/`结尾，超过4GB的文件自动使用Zip64
+//zip无法表示硬链接、设备文件和命名管道：硬链接打包为普通文件，后两者跳过；
+//压缩格式相关的选项（例如WithCompression、WithGzipLevel）不起作用，文件内容总是用Deflate压缩
+func Zip(src string, dest string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	o.srcForm(src)
+	src = filepath.Clean(src)
+	if !Exists(src) {
+		return errors.New("要打包的文件或者目录不存在：" + src)
+	}
+
+	d, err := createDest(dest, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = d.finish(err)
+	}()
+
+	zw := zip.NewWriter(d.f)
+	defer func() {
+		if er := zw.Close(); er != nil && err == nil {
+			err = er
+		}
+	}()
+
+	//沿用tar的遍历：在另一个goroutine中生成不压缩的tar流，再逐项转换为zip
+	o.compression = None
+	o.compressor = nil
+	o.noHardLinks = true
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	var partial error
+	go func() {
+		defer close(done)
+		err := tarToWriter(context.Background(), pw, o, func(p *packer) error {
+			return p.tarSrc(src)
+		})
+		//部分项出错时tar流仍然是完整的，转换完成后再返回这个错误
+		if isPartial(err) {
+			partial, err = err, nil
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = tarToZip(tar.NewReader(pr), zw)
+	//转换出错时让生成tar流的goroutine尽快结束
+	pr.CloseWithError(errors.New("转换为zip失败"))
+	<-done
+	if err != nil {
+		return err
+	}
+	return partial
+}
+
+//把tr中的每一项写入zw，tar中无法用zip表示的项（设备文件、命名管道）会被跳过
+func tarToZip(tr *tar.Reader, zw *zip.Writer) error {
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+		case tar.TypeLink:
+			return fmt.Errorf("zip无法表示硬链接：%s", hdr.Name)
+		default:
+			continue
+		}
+
+		zh, err := zip.FileInfoHeader(hdr.FileInfo())
+		if err != nil {
+			return err
+		}
+		zh.Name = hdr.Name
+		zh.Modified = hdr.ModTime
+
+		var content io.Reader = tr
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			//其他工具按结尾的`/`识别目录
+			if !strings.HasSuffix(zh.Name, "/") {
+				zh.Name += "/"
+			}
+			zh.Method = zip.Store
+		case tar.TypeSymlink:
+			//和Info-ZIP一样，符号链接的内容是链接的目标
+			zh.Method = zip.Store
+			content = strings.NewReader(hdr.Linkname)
+		}
+
+		w, err := zw.CreateHeader(zh)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			if _, err := io.Copy(w, content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//将.zip文件解压到dstDir文件夹下，和UnTar一样会拒绝超出dstDir的路径，返回ErrUnsafePath
+//有Unix权限的项按保存的权限还原，符号链接还原为符号链接
+func UnZip(src string, dstDir string, opts ...Option) (err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	start := time.Now()
+	u := newUnpacker(context.Background(), dstDir, o)
+	defer func() {
+		u.fillStats(time.Since(start))
+	}()
+	//zip中的各项可以单独读取，压缩比按各项记录的压缩后大小计算
+	var compressed int64
+	u.compressed = &compressed
+	for _, f := range zr.File {
+		compressed += int64(f.CompressedSize64)
+		if err := u.unZipEntry(f); err != nil {
+			if err := u.entryFailed(f.Name, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	u.restoreDirs()
+	return multiError(u.errs)
+}
+
+//把zip中的一项转换为tar头，交给unTarEntry解压
+func (u *unpacker) unZipEntry(f *zip.File) error {
+	fi := f.FileInfo()
+	hdr := &tar.Header{
+		Name:     f.Name,
+		Mode:     int64(fi.Mode().Perm()),
+		ModTime:  f.Modified,
+		Typeflag: tar.TypeReg,
+	}
+	if !fi.IsDir() && fi.Mode()&os.ModeSymlink == 0 {
+		hdr.Size = int64(f.UncompressedSize64)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	switch {
+	case fi.IsDir():
+		hdr.Typeflag = tar.TypeDir
+	case fi.Mode()&os.ModeSymlink != 0:
+		link, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = string(link)
+	}
+	return u.unTarEntry(rc, hdr)
+}